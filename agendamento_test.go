@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"sql-connect/internal/fakesoc"
+)
+
+// proximo dia util depois de hoje em Sao Paulo, fora dos feriados do Blip falso
+func proximoDiaUtil() time.Time {
+	dia := inicioDoDia(agoraSaoPaulo()).AddDate(0, 0, 1)
+	for dia.Weekday() == time.Saturday || dia.Weekday() == time.Sunday || isDateInIntervals(dia, feriadosTesteParseados()) {
+		dia = dia.AddDate(0, 0, 1)
+	}
+	return dia
+}
+
+func feriadosTesteParseados() [][2]time.Time {
+	feriados, _ := parseDateIntervals(feriadosTeste)
+	return feriados
+}
+
+// fixtures padrao com todas as vagas das agendas no dia informado
+func fixturesNoDia(t *testing.T, dia time.Time) fakesoc.Fixtures {
+	t.Helper()
+	f := fixturesPadrao(t)
+	for _, registros := range f.Agendas {
+		for _, r := range registros {
+			r["data"] = dia.Format("02/01/2006")
+		}
+	}
+	return f
+}
+
+// chama o handler de agendamento autenticado com o principal informado
+func chamarAgendamento(t *testing.T, p *Principal, metodo string, q url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(metodo, "/api/v1/agendamento?"+q.Encode(), nil)
+	req = req.WithContext(context.WithValue(req.Context(), principalKey, p))
+	rec := httptest.NewRecorder()
+	handleAgendamento(rec, req)
+	return rec
+}
+
+// horarios da lista devolvida pelo GET de um dia
+func horariosDaResposta(t *testing.T, rec *httptest.ResponseRecorder) []string {
+	t.Helper()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET agendamento respondeu %d: %s", rec.Code, rec.Body.String())
+	}
+	var lista []Horario
+	if err := json.Unmarshal(rec.Body.Bytes(), &lista); err != nil {
+		t.Fatalf("resposta inválida %q: %v", rec.Body.String(), err)
+	}
+	horarios := []string{}
+	for _, h := range lista {
+		horarios = append(horarios, h.Horario)
+	}
+	return horarios
+}
+
+func TestAgendarConsomeVagaNoSOCFalso(t *testing.T) {
+	dia := proximoDiaUtil()
+	data := dia.Format("02/01/2006")
+	fs := novoSOCFalso(t, fixturesNoDia(t, dia))
+	principal := &Principal{Tipo: "apikey", Tenant: "teste", Escopos: []string{escopoTodosEndpoints}}
+
+	// fixtures: clientes com 2 vagas as 08:00 e 1 as 08:30, Proteger com 2 e 3
+	antes := horariosDaResposta(t, chamarAgendamento(t, principal, "GET", url.Values{"data": {data}}))
+	if !slices.Equal(antes, []string{"08:00", "08:30"}) {
+		t.Fatalf("horarios antes do agendamento = %v", antes)
+	}
+
+	rec := chamarAgendamento(t, principal, "POST", url.Values{
+		"data": {data}, "hora": {"08:30"}, "compromisso": {"EXAME"}, "empresa": {cfg.SOC.EmpresaPrincipal},
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST agendamento respondeu %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := fs.Chamadas(fakesoc.AlvoIncluirAgendamento); got != 1 {
+		t.Fatalf("incluirAgendamento chamado %d vezes", got)
+	}
+
+	// a unica vaga da agenda clientes as 08:30 foi ocupada
+	depois := horariosDaResposta(t, chamarAgendamento(t, principal, "GET", url.Values{"data": {data}}))
+	if !slices.Equal(depois, []string{"08:00"}) {
+		t.Fatalf("horarios depois do agendamento = %v", depois)
+	}
+	rec = chamarAgendamento(t, principal, "GET", url.Values{"data": {data}, "hora": {"08:30"}})
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("horario ocupado respondeu %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestConsultaComEmpresaExigeAutorizacao(t *testing.T) {
+	dia := proximoDiaUtil()
+	data := dia.Format("02/01/2006")
+	novoSOCFalso(t, fixturesNoDia(t, dia))
+	restrito := &Principal{Tipo: "jwt", Tenant: "portal", Escopos: []string{"agendamento:read"}, Empresas: []string{"100"}}
+	casos := []struct {
+		nome   string
+		q      url.Values
+		status int
+	}{
+		{"dia com empresa do token", url.Values{"data": {data}, "empresa": {"100"}}, http.StatusOK},
+		{"dia com outra empresa", url.Values{"data": {data}, "empresa": {"200"}}, http.StatusForbidden},
+		{"periodo com outra empresa", url.Values{"inicio": {data}, "empresa": {"200"}}, http.StatusForbidden},
+		{"periodo com empresa do token", url.Values{"inicio": {data}, "empresa": {"100"}}, http.StatusOK},
+		{"sem empresa", url.Values{"data": {data}}, http.StatusOK},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			if rec := chamarAgendamento(t, restrito, "GET", c.q); rec.Code != c.status {
+				t.Errorf("GET %s respondeu %d, esperava %d: %s", c.q.Encode(), rec.Code, c.status, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestProximosComEmpresaExigeAutorizacao(t *testing.T) {
+	novoSOCFalso(t, fixturesNoDia(t, proximoDiaUtil()))
+	restrito := &Principal{Tipo: "jwt", Tenant: "portal", Escopos: []string{"agendamento:read"}, Empresas: []string{"100"}}
+	proximos := func(q url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/v1/agendamento/proximos?"+q.Encode(), nil)
+		req = req.WithContext(context.WithValue(req.Context(), principalKey, restrito))
+		rec := httptest.NewRecorder()
+		handleProximosHorarios(rec, req)
+		return rec
+	}
+	if rec := proximos(url.Values{"empresa": {"200"}}); rec.Code != http.StatusForbidden {
+		t.Errorf("proximos com outra empresa respondeu %d: %s", rec.Code, rec.Body.String())
+	}
+	rec := proximos(url.Values{"empresa": {"100"}, "quantidade": {"2"}})
+	if got := horariosDaResposta(t, rec); !slices.Equal(got, []string{"08:00", "08:30"}) {
+		t.Errorf("proximos com a empresa do token = %v", got)
+	}
+}
+
+func TestConsultaComFalhaNoBlipRespondeErro(t *testing.T) {
+	dia := proximoDiaUtil()
+	fs := novoSOCFalso(t, fixturesNoDia(t, dia))
+	principal := &Principal{Tipo: "apikey", Tenant: "teste", Escopos: []string{escopoTodosEndpoints}}
+
+	// sem a lista de feriados o dia nao pode ser dado como dia comum
+	statusBlipTeste.Store(http.StatusInternalServerError)
+	rec := chamarAgendamento(t, principal, "GET", url.Values{"data": {dia.Format("02/01/2006")}})
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("GET com o Blip fora respondeu %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := fs.Chamadas(fakesoc.AlvoAgendamentos); got == 0 {
+		t.Error("as agendas deveriam ser consultadas mesmo com o Blip fora")
+	}
+}
+
+func TestPeriodoComFalhaNoBlipRespondeErro(t *testing.T) {
+	dia := proximoDiaUtil()
+	novoSOCFalso(t, fixturesNoDia(t, dia))
+	principal := &Principal{Tipo: "apikey", Tenant: "teste", Escopos: []string{escopoTodosEndpoints}}
+	q := url.Values{"inicio": {dia.Format("02/01/2006")}, "fim": {dia.AddDate(0, 0, 7).Format("02/01/2006")}}
+
+	if rec := chamarAgendamento(t, principal, "GET", q); rec.Code != http.StatusOK {
+		t.Fatalf("GET periodo com o Blip no ar respondeu %d: %s", rec.Code, rec.Body.String())
+	}
+	// sem a lista de feriados os feriados do periodo voltariam como dias livres
+	statusBlipTeste.Store(http.StatusInternalServerError)
+	if rec := chamarAgendamento(t, principal, "GET", q); rec.Code != http.StatusBadGateway {
+		t.Fatalf("GET periodo com o Blip fora respondeu %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestProximosComFalhaNoBlipNaoOfereceHorarios(t *testing.T) {
+	novoSOCFalso(t, fixturesNoDia(t, proximoDiaUtil()))
+	principal := &Principal{Tipo: "apikey", Tenant: "teste", Escopos: []string{escopoTodosEndpoints}}
+	req := httptest.NewRequest("GET", "/api/v1/agendamento/proximos?quantidade=2", nil)
+	req = req.WithContext(context.WithValue(req.Context(), principalKey, principal))
+
+	// sem a lista de feriados nao da para saber se o dia das vagas é feriado, que o POST recusaria
+	statusBlipTeste.Store(http.StatusInternalServerError)
+	rec := httptest.NewRecorder()
+	handleProximosHorarios(rec, req)
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("proximos com o Blip fora respondeu %d: %s", rec.Code, rec.Body.String())
+	}
+	var horarios []Horario
+	if err := json.Unmarshal(rec.Body.Bytes(), &horarios); err == nil && len(horarios) > 0 {
+		t.Errorf("proximos com o Blip fora ofereceu horarios: %v", horarios)
+	}
+}
+
+func TestFalhaNosFeriadosMesmaRegraEmTodasAsConsultas(t *testing.T) {
+	dia := proximoDiaUtil()
+	novoSOCFalso(t, fixturesNoDia(t, dia))
+	statusBlipTeste.Store(http.StatusInternalServerError)
+	agora := agoraSaoPaulo()
+	ctx := context.Background()
+	consultas := []struct {
+		nome     string
+		consulta func() error
+	}{
+		{"dia", func() error {
+			_, err := consultarDia(ctx, dia, filtroAgenda{})
+			return err
+		}},
+		{"periodo", func() error {
+			_, err := consultarPeriodo(ctx, dia, dia.AddDate(0, 0, 7), agora, filtroAgenda{})
+			return err
+		}},
+		{"proximos", func() error {
+			_, err := proximosHorarios(ctx, dia, dia.AddDate(0, 0, 7), agora, 2, filtroAgenda{})
+			return err
+		}},
+	}
+	for _, c := range consultas {
+		t.Run(c.nome, func(t *testing.T) {
+			err := c.consulta()
+			if !errors.Is(err, ErrFeriadosIndisponiveis) {
+				t.Fatalf("erro = %v, esperava ErrFeriadosIndisponiveis", err)
+			}
+			if apiErr := socError(err, "erro"); apiErr.Status != http.StatusBadGateway {
+				t.Errorf("status da resposta = %d", apiErr.Status)
+			}
+		})
+	}
+}
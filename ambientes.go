@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ambientes do SOC com valores prontos
+const (
+	socAmbienteProducao    = "producao"
+	socAmbienteHomologacao = "homologacao"
+	socAmbienteLocal       = "local"
+)
+
+// host do SOC de produção, bloqueado nos outros ambientes
+const socHostProducao = "ws1.soc.com.br"
+
+// valores usados quando o campo nao foi configurado, o ambiente local aponta
+// para o cmd/fakesoc com as mesmas credenciais das fixtures do internal/fakesoc.
+// homologação nao tem valores prontos, o endereço e as credenciais vem da configuração
+var socAmbientesPadrao = map[string]SOCAmbiente{
+	socAmbienteProducao: {
+		BaseURL: "https://" + socHostProducao,
+	},
+	socAmbienteHomologacao: {},
+	socAmbienteLocal: {
+		BaseURL:           "http://localhost:8089",
+		EmpresaPrincipal:  "100",
+		CodigoResponsavel: "1",
+		CodigoUsuario:     "1",
+		Usuario:           "fake",
+		Senha:             "fake",
+		AgendaClientes:    "5001",
+		AgendaProteger:    "5002",
+		Exportadados: ExportadadosConfig{
+			Empresas:     ExportaDadosCredencial{Codigo: "1001", Chave: "chave-empresas"},
+			Setores:      ExportaDadosCredencial{Codigo: "1002", Chave: "chave-setores"},
+			Hierarquia:   ExportaDadosCredencial{Codigo: "1003", Chave: "chave-hierarquia"},
+			Funcionarios: ExportaDadosCredencial{Codigo: "1004", Chave: "chave-funcionarios"},
+			Agendamentos: ExportaDadosCredencial{Codigo: "1005", Chave: "chave-agendamentos"},
+		},
+	},
+}
+
+// aplica o ambiente ativo: os campos de soc.ambientes.<nome> sobrescrevem os de soc
+// e os valores prontos do ambiente preenchem o que continuar vazio
+func (c *Config) aplicarAmbienteSOC() {
+	var configurado, padrao Config
+	configurado.SOC.SOCAmbiente = c.SOC.Ambientes[c.SOC.Ambiente]
+	padrao.SOC.SOCAmbiente = socAmbientesPadrao[c.SOC.Ambiente]
+	destino, origem, prontos := c.camposSOC(), configurado.camposSOC(), padrao.camposSOC()
+	for i, campo := range destino {
+		if v := *origem[i]; v != "" {
+			*campo = v
+		}
+		if *campo == "" {
+			*campo = *prontos[i]
+		}
+	}
+}
+
+// campos de endereço e credenciais do SOC, na mesma ordem para qualquer configuração
+func (c *Config) camposSOC() []*string {
+	var campos []*string
+	for _, campo := range c.campos() {
+		if p, ok := campo.valor.(*string); ok && strings.HasPrefix(campo.nome, "soc.") && campo.nome != "soc.ambiente" {
+			campos = append(campos, p)
+		}
+	}
+	return campos
+}
+
+// o ambiente precisa existir e so produção pode apontar para o SOC de produção
+func (c *Config) validarAmbienteSOC() error {
+	_, pronto := socAmbientesPadrao[c.SOC.Ambiente]
+	_, configurado := c.SOC.Ambientes[c.SOC.Ambiente]
+	if !pronto && !configurado {
+		return fmt.Errorf("soc.ambiente %q desconhecido, use %s, %s, %s ou um ambiente de soc.ambientes",
+			c.SOC.Ambiente, socAmbienteProducao, socAmbienteHomologacao, socAmbienteLocal)
+	}
+	if c.SOC.Ambiente == socAmbienteProducao || c.SOC.BaseURL == "" {
+		return nil
+	}
+	u, err := url.Parse(c.SOC.BaseURL)
+	if err != nil {
+		return fmt.Errorf("soc.base_url inválida: %w", err)
+	}
+	if strings.EqualFold(u.Hostname(), socHostProducao) {
+		return fmt.Errorf("soc.base_url aponta para o SOC de produção no ambiente %q", c.SOC.Ambiente)
+	}
+	return nil
+}
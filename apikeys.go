@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// prefixo das chaves geradas pela aplicação
+const apiKeyPrefix = "soc_"
+
+// escopo que libera todos os endpoints
+const escopoTodosEndpoints = "*"
+
+// erros de autenticação por chave
+var (
+	ErrAPIKeyAusente  = errors.New("chave de api ausente")
+	ErrAPIKeyInvalida = errors.New("chave de api inválida")
+	ErrAPIKeyExpirada = errors.New("chave de api expirada")
+	ErrAPIKeyRevogada = errors.New("chave de api revogada")
+	ErrEscopoNegado   = errors.New("sem permissão para este endpoint")
+	ErrChaveNaoExiste = errors.New("chave de api não encontrada")
+)
+
+// escopos conhecidos, um para cada endpoint e metodo
+var escoposValidos = []string{
+	"empresa:read",
+	"setor:read",
+	"cargo:read",
+	"funcionario:read",
+	"funcionario:write",
+	"agendamento:read",
+	"agendamento:write",
+	"cache:write",
+}
+
+// estrutura da chave de api armazenada no banco
+type APIKey struct {
+	ID         int
+	Prefixo    string
+	Tenant     string
+	Escopos    []string
+	ExpiraEm   sql.NullTime
+	RevogadaEm sql.NullTime
+	CriadaEm   time.Time
+}
+
+// cria a tabela de chaves de api
+func createAPIKeyTable(db *sql.DB) error {
+	query := `CREATE TABLE IF NOT EXISTS api_keys (
+    id SERIAL PRIMARY KEY,
+    prefixo VARCHAR(16) NOT NULL UNIQUE,
+    hash CHAR(64) NOT NULL,
+    tenant VARCHAR(100) NOT NULL,
+    escopos TEXT[] NOT NULL,
+    expira_em TIMESTAMPTZ,
+    revogada_em TIMESTAMPTZ,
+    criada_em TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);`
+	_, err := db.Exec(query)
+	return err
+}
+
+// gera uma nova chave, retorna o texto completo e o prefixo usado na busca
+func generateAPIKey() (chave, prefixo string, err error) {
+	p := make([]byte, 4)
+	s := make([]byte, 32)
+	if _, err = rand.Read(p); err != nil {
+		return "", "", err
+	}
+	if _, err = rand.Read(s); err != nil {
+		return "", "", err
+	}
+	prefixo = hex.EncodeToString(p)
+	return apiKeyPrefix + prefixo + "_" + hex.EncodeToString(s), prefixo, nil
+}
+
+// hash sha256 da chave completa, a chave em texto nunca é salva
+func hashAPIKey(chave string) string {
+	sum := sha256.Sum256([]byte(chave))
+	return hex.EncodeToString(sum[:])
+}
+
+// separa o prefixo da chave recebida
+func parseAPIKeyPrefix(chave string) (string, bool) {
+	resto, ok := strings.CutPrefix(chave, apiKeyPrefix)
+	if !ok {
+		return "", false
+	}
+	prefixo, _, ok := strings.Cut(resto, "_")
+	return prefixo, ok && prefixo != ""
+}
+
+// *sql.DB ou *sql.Tx, para a inserção da chave rodar dentro da transação da rotação
+type consultaSQL interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// insere uma nova chave para o tenant e retorna o texto da chave
+func insertAPIKey(db consultaSQL, tenant string, escopos []string, expiraEm sql.NullTime) (string, *APIKey, error) {
+	chave, prefixo, err := generateAPIKey()
+	if err != nil {
+		return "", nil, err
+	}
+	key := &APIKey{Prefixo: prefixo, Tenant: tenant, Escopos: escopos, ExpiraEm: expiraEm}
+	query := `INSERT INTO api_keys (prefixo, hash, tenant, escopos, expira_em)
+	VALUES ($1, $2, $3, $4, $5) RETURNING id, criada_em`
+	err = db.QueryRow(query, prefixo, hashAPIKey(chave), tenant, pq.Array(escopos), expiraEm).Scan(&key.ID, &key.CriadaEm)
+	if err != nil {
+		return "", nil, err
+	}
+	return chave, key, nil
+}
+
+// consulta da chave pelo prefixo, a rotação usa com FOR UPDATE dentro da transação
+const queryAPIKeyPorPrefixo = `SELECT id, prefixo, hash, tenant, escopos, expira_em, revogada_em, criada_em
+	FROM api_keys WHERE prefixo = $1`
+
+// busca a chave pelo prefixo
+func fetchAPIKeyByPrefix(ctx context.Context, db *sql.DB, prefixo string) (*APIKey, string, error) {
+	return scanAPIKey(db.QueryRowContext(ctx, queryAPIKeyPorPrefixo, prefixo))
+}
+
+// le a chave e o hash da linha de queryAPIKeyPorPrefixo
+func scanAPIKey(row *sql.Row) (*APIKey, string, error) {
+	var key APIKey
+	var hash string
+	err := row.Scan(&key.ID, &key.Prefixo, &hash, &key.Tenant, pq.Array(&key.Escopos), &key.ExpiraEm, &key.RevogadaEm, &key.CriadaEm)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, "", ErrChaveNaoExiste
+		}
+		return nil, "", err
+	}
+	return &key, hash, nil
+}
+
+// lista todas as chaves cadastradas
+func fetchAPIKeys(db *sql.DB) ([]*APIKey, error) {
+	query := `SELECT id, prefixo, tenant, escopos, expira_em, revogada_em, criada_em
+	FROM api_keys ORDER BY tenant, criada_em`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []*APIKey
+	for rows.Next() {
+		var key APIKey
+		if err := rows.Scan(&key.ID, &key.Prefixo, &key.Tenant, pq.Array(&key.Escopos), &key.ExpiraEm, &key.RevogadaEm, &key.CriadaEm); err != nil {
+			return nil, err
+		}
+		keys = append(keys, &key)
+	}
+	return keys, rows.Err()
+}
+
+// revoga a chave imediatamente
+func revokeAPIKey(db *sql.DB, prefixo string) error {
+	res, err := db.Exec(`UPDATE api_keys SET revogada_em = NOW() WHERE prefixo = $1 AND revogada_em IS NULL`, prefixo)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrChaveNaoExiste
+	}
+	return nil
+}
+
+// a chave expira no proprio instante de expira_em, a mesma regra vale para a autenticação,
+// a listagem e a rotação
+func expirada(k *APIKey, agora time.Time) bool {
+	return k.ExpiraEm.Valid && !agora.Before(k.ExpiraEm.Time)
+}
+
+// confere se a chave pode ser rotacionada e calcula a validade da nova,
+// que recebe o mesmo tempo de validade da antiga contado a partir de agora
+func conferirRotacao(antiga *APIKey, agora time.Time) (sql.NullTime, error) {
+	if antiga.RevogadaEm.Valid {
+		return sql.NullTime{}, ErrAPIKeyRevogada
+	}
+	if expirada(antiga, agora) {
+		return sql.NullTime{}, ErrAPIKeyExpirada
+	}
+	if !antiga.ExpiraEm.Valid {
+		return sql.NullTime{}, nil
+	}
+	return sql.NullTime{Time: agora.Add(antiga.ExpiraEm.Time.Sub(antiga.CriadaEm)), Valid: true}, nil
+}
+
+// cria uma chave nova com os mesmos dados e faz a antiga expirar depois da carencia, retorna
+// tambem quando a antiga expira. a antiga é lida com FOR UPDATE e as alterações vao na mesma
+// transação, entao duas rotações ou uma revogação ao mesmo tempo esperam uma pela outra
+func rotateAPIKey(db *sql.DB, prefixo string, carencia time.Duration) (string, *APIKey, time.Time, error) {
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", nil, time.Time{}, err
+	}
+	defer tx.Rollback()
+	antiga, _, err := scanAPIKey(tx.QueryRowContext(ctx, queryAPIKeyPorPrefixo+" FOR UPDATE", prefixo))
+	if err != nil {
+		return "", nil, time.Time{}, err
+	}
+	agora := time.Now()
+	expiraEm, err := conferirRotacao(antiga, agora)
+	if err != nil {
+		return "", nil, time.Time{}, err
+	}
+	chave, nova, err := insertAPIKey(tx, antiga.Tenant, antiga.Escopos, expiraEm)
+	if err != nil {
+		return "", nil, time.Time{}, err
+	}
+	fim := agora.Add(carencia)
+	if antiga.ExpiraEm.Valid && antiga.ExpiraEm.Time.Before(fim) {
+		fim = antiga.ExpiraEm.Time
+	}
+	if _, err := tx.Exec(`UPDATE api_keys SET expira_em = $1 WHERE id = $2`, fim, antiga.ID); err != nil {
+		return "", nil, time.Time{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", nil, time.Time{}, err
+	}
+	return chave, nova, fim, nil
+}
+
+// valida a chave recebida e retorna os dados dela
+func verifyAPIKey(ctx context.Context, db *sql.DB, chave string) (*APIKey, error) {
+	prefixo, ok := parseAPIKeyPrefix(chave)
+	if !ok {
+		return nil, ErrAPIKeyInvalida
+	}
+	key, hash, err := fetchAPIKeyByPrefix(ctx, db, prefixo)
+	if err != nil {
+		if errors.Is(err, ErrChaveNaoExiste) {
+			return nil, ErrAPIKeyInvalida
+		}
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(hashAPIKey(chave))) != 1 {
+		return nil, ErrAPIKeyInvalida
+	}
+	if key.RevogadaEm.Valid {
+		return nil, ErrAPIKeyRevogada
+	}
+	if expirada(key, time.Now()) {
+		return nil, ErrAPIKeyExpirada
+	}
+	return key, nil
+}
+
+// valida a lista de escopos informada no comando
+func parseEscopos(s string) ([]string, error) {
+	var escopos []string
+	for _, e := range strings.Split(s, ",") {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		if e != escopoTodosEndpoints && !containsString(escoposValidos, e) {
+			return nil, fmt.Errorf("escopo desconhecido %q, use um de: %s ou %s", e, strings.Join(escoposValidos, ", "), escopoTodosEndpoints)
+		}
+		escopos = append(escopos, e)
+	}
+	if len(escopos) == 0 {
+		return nil, errors.New("pelo menos um escopo é obrigatório")
+	}
+	return escopos, nil
+}
+
+// verifica se a string esta dentro do slice
+func containsString(lista []string, s string) bool {
+	for _, v := range lista {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// comando administrativo: apikey create|rotate|revoke|list
+func runAPIKeyCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("uso: apikey create|rotate|revoke|list [opções]")
+	}
+	if err := createAPIKeyTable(db); err != nil {
+		return fmt.Errorf("erro ao criar tabela de chaves: %w", err)
+	}
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("apikey create", flag.ExitOnError)
+		tenant := fs.String("tenant", "", "nome do integrador dono da chave")
+		escopos := fs.String("escopos", "", "escopos separados por virgula ("+strings.Join(escoposValidos, ", ")+" ou *)")
+		validade := fs.Duration("validade", 0, "tempo de validade da chave, 0 para nao expirar")
+		fs.Parse(args[1:])
+		if strings.TrimSpace(*tenant) == "" {
+			return errors.New("-tenant é obrigatório")
+		}
+		lista, err := parseEscopos(*escopos)
+		if err != nil {
+			return err
+		}
+		var expira sql.NullTime
+		if *validade > 0 {
+			expira = sql.NullTime{Time: time.Now().Add(*validade), Valid: true}
+		}
+		chave, key, err := insertAPIKey(db, *tenant, lista, expira)
+		if err != nil {
+			return err
+		}
+		printAPIKey(chave, key)
+	case "rotate":
+		fs := flag.NewFlagSet("apikey rotate", flag.ExitOnError)
+		prefixo := fs.String("prefixo", "", "prefixo da chave a ser rotacionada")
+		carencia := fs.Duration("carencia", 24*time.Hour, "tempo que a chave antiga continua valida")
+		fs.Parse(args[1:])
+		chave, key, fim, err := rotateAPIKey(db, *prefixo, *carencia)
+		if err != nil {
+			return err
+		}
+		log.Printf("chave %s expira em %s", *prefixo, fim.Format(time.RFC3339))
+		printAPIKey(chave, key)
+	case "revoke":
+		fs := flag.NewFlagSet("apikey revoke", flag.ExitOnError)
+		prefixo := fs.String("prefixo", "", "prefixo da chave a ser revogada")
+		fs.Parse(args[1:])
+		if err := revokeAPIKey(db, *prefixo); err != nil {
+			return err
+		}
+		log.Printf("chave %s revogada", *prefixo)
+	case "list":
+		keys, err := fetchAPIKeys(db)
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			status := "ativa"
+			if k.RevogadaEm.Valid {
+				status = "revogada"
+			} else if expirada(k, time.Now()) {
+				status = "expirada"
+			}
+			fmt.Fprintf(os.Stdout, "%s\t%s\t%s\t%s\n", k.Prefixo, k.Tenant, strings.Join(k.Escopos, ","), status)
+		}
+	default:
+		return fmt.Errorf("subcomando desconhecido %q", args[0])
+	}
+	return nil
+}
+
+// mostra a chave criada, ela nao pode ser recuperada depois
+func printAPIKey(chave string, key *APIKey) {
+	fmt.Fprintf(os.Stdout, "tenant:  %s\nescopos: %s\nprefixo: %s\nchave:   %s\n", key.Tenant, strings.Join(key.Escopos, ","), key.Prefixo, chave)
+	if key.ExpiraEm.Valid {
+		fmt.Fprintf(os.Stdout, "expira:  %s\n", key.ExpiraEm.Time.Format(time.RFC3339))
+	}
+	fmt.Fprintln(os.Stdout, "guarde a chave agora, ela não será exibida novamente")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConferirRotacao(t *testing.T) {
+	agora := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	criada := agora.AddDate(0, 0, -30)
+	casos := []struct {
+		nome   string
+		chave  APIKey
+		expira sql.NullTime
+		erro   error
+	}{
+		{"sem validade", APIKey{CriadaEm: criada}, sql.NullTime{}, nil},
+		{
+			"validade renovada a partir de agora",
+			APIKey{CriadaEm: criada, ExpiraEm: sql.NullTime{Time: criada.AddDate(0, 0, 90), Valid: true}},
+			sql.NullTime{Time: agora.AddDate(0, 0, 90), Valid: true},
+			nil,
+		},
+		{"expirada", APIKey{CriadaEm: criada, ExpiraEm: sql.NullTime{Time: agora.Add(-time.Minute), Valid: true}}, sql.NullTime{}, ErrAPIKeyExpirada},
+		{"expira agora", APIKey{CriadaEm: criada, ExpiraEm: sql.NullTime{Time: agora, Valid: true}}, sql.NullTime{}, ErrAPIKeyExpirada},
+		{"revogada", APIKey{CriadaEm: criada, RevogadaEm: sql.NullTime{Time: criada, Valid: true}}, sql.NullTime{}, ErrAPIKeyRevogada},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			expira, err := conferirRotacao(&c.chave, agora)
+			if !errors.Is(err, c.erro) {
+				t.Fatalf("erro = %v, esperava %v", err, c.erro)
+			}
+			if expira.Valid != c.expira.Valid || !expira.Time.Equal(c.expira.Time) {
+				t.Errorf("validade da chave nova = %+v, esperava %+v", expira, c.expira)
+			}
+		})
+	}
+}
+
+func TestExpirada(t *testing.T) {
+	agora := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	casos := []struct {
+		nome     string
+		expiraEm sql.NullTime
+		expirada bool
+	}{
+		{"sem validade", sql.NullTime{}, false},
+		{"expira depois", sql.NullTime{Time: agora.Add(time.Nanosecond), Valid: true}, false},
+		{"expira agora", sql.NullTime{Time: agora, Valid: true}, true},
+		{"expirou antes", sql.NullTime{Time: agora.Add(-time.Nanosecond), Valid: true}, true},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			if got := expirada(&APIKey{ExpiraEm: c.expiraEm}, agora); got != c.expirada {
+				t.Errorf("expirada = %v, esperava %v", got, c.expirada)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// erro quando o token nao libera a empresa pedida
+var ErrEmpresaNegada = errors.New("empresa não permitida para este token")
+
+// quem esta chamando a api, vindo de uma chave de api ou de um jwt
+type Principal struct {
+	Tipo     string
+	Tenant   string
+	Escopos  []string
+	Empresas []string // nil libera todas as empresas, lista vazia nao libera nenhuma
+}
+
+// verifica se o principal pode acessar o escopo
+func (p *Principal) permite(escopo string) bool {
+	for _, e := range p.Escopos {
+		if e == escopoTodosEndpoints || e == escopo {
+			return true
+		}
+	}
+	return false
+}
+
+// verifica se o principal pode usar o codigo de empresa informado, sem restrição
+// de empresas (chave de api ou jwt sem a claim empresa) libera todas
+func (p *Principal) permiteEmpresa(empresa string) bool {
+	if p.Empresas == nil {
+		return true
+	}
+	return containsString(p.Empresas, strings.TrimSpace(empresa))
+}
+
+// verifica a autenticação da requisição e se ela pode acessar o escopo,
+// retorna o status http a ser usado em caso de erro
+func autorizar(r *http.Request, escopo string) (*Principal, int, error) {
+	header := strings.TrimSpace(r.Header.Get("Authorization"))
+	if header == "" {
+		return nil, http.StatusUnauthorized, ErrAPIKeyAusente
+	}
+	var principal *Principal
+	var err error
+	if token, ok := cutBearer(header); ok {
+		principal, err = verifyJWT(token)
+	} else {
+		principal, err = principalFromAPIKey(r.Context(), header)
+	}
+	if err != nil {
+		if errors.Is(err, ErrAPIKeyInvalida) || errors.Is(err, ErrAPIKeyExpirada) || errors.Is(err, ErrAPIKeyRevogada) ||
+			errors.Is(err, ErrJWTInvalido) || errors.Is(err, ErrJWTDesabilitado) {
+			return nil, http.StatusUnauthorized, err
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+	if !principal.permite(escopo) {
+		return nil, http.StatusForbidden, fmt.Errorf("%w: %s %s, escopo %s", ErrEscopoNegado, principal.Tipo, principal.Tenant, escopo)
+	}
+	return principal, http.StatusOK, nil
+}
+
+// verifica se o principal pode consultar a empresa, retorna o status do erro
+func autorizarEmpresa(p *Principal, empresa string) (int, error) {
+	if !p.permiteEmpresa(empresa) {
+		return http.StatusForbidden, fmt.Errorf("%w: %s %s, empresa %s", ErrEmpresaNegada, p.Tipo, p.Tenant, empresa)
+	}
+	return http.StatusOK, nil
+}
+
+// separa o token do esquema Bearer
+func cutBearer(header string) (string, bool) {
+	esquema, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(esquema, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// converte a chave de api em principal, chaves nao tem restrição de empresa
+func principalFromAPIKey(ctx context.Context, chave string) (*Principal, error) {
+	key, err := verifyAPIKey(ctx, db, chave)
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{
+		Tipo:    "apikey",
+		Tenant:  key.Tenant,
+		Escopos: key.Escopos,
+	}, nil
+}
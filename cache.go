@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/singleflight"
+)
+
+// cache em memoria com tempo de vida, chamadas simultaneas para a mesma chave
+// sao agrupadas em uma unica busca no SOC
+type ttlCache[T any] struct {
+	nome  string
+	ttl   func() time.Duration
+	mu    sync.Mutex
+	itens map[string]cacheItem[T]
+	grupo singleflight.Group
+	// geração de cada chave, incrementada a cada invalidação para descartar as buscas
+	// da chave que ja estavam em andamento. so tem as chaves que ja foram invalidadas
+	geracoes map[string]uint64
+}
+
+// valor guardado no cache com o momento em que expira
+type cacheItem[T any] struct {
+	valor  T
+	expira time.Time
+}
+
+func newTTLCache[T any](nome string, ttl func() time.Duration) *ttlCache[T] {
+	return &ttlCache[T]{nome: nome, ttl: ttl, itens: make(map[string]cacheItem[T]), geracoes: make(map[string]uint64)}
+}
+
+// exports do SOC em cache
+var (
+	setoresCache    = newTTLCache[map[string][]Setor]("setores", func() time.Duration { return cfg.Cache.SetoresTTL })
+	hierarquiaCache = newTTLCache[[]Cargos_Setores]("hierarquia", func() time.Duration { return cfg.Cache.HierarquiaTTL })
+)
+
+// devolve o valor em cache ou busca no SOC, com ttl zero o cache fica desligado
+func (c *ttlCache[T]) get(ctx context.Context, chave string, buscar func(context.Context) (T, error)) (T, error) {
+	ttl := c.ttl()
+	if ttl <= 0 {
+		return buscar(ctx)
+	}
+	c.mu.Lock()
+	item, ok := c.itens[chave]
+	geracao := c.geracoes[chave]
+	c.mu.Unlock()
+	if ok && time.Now().Before(item.expira) {
+		cacheRequests.With(prometheus.Labels{"cache": c.nome, "resultado": "hit"}).Inc()
+		return item.valor, nil
+	}
+	cacheRequests.With(prometheus.Labels{"cache": c.nome, "resultado": "miss"}).Inc()
+	// a busca compartilhada nao pode ser cancelada pela desistencia de um dos chamadores,
+	// o tempo limite do cliente http continua valendo
+	ch := c.grupo.DoChan(chave, func() (any, error) {
+		valor, err := buscar(context.WithoutCancel(ctx))
+		if err != nil {
+			return valor, err
+		}
+		c.mu.Lock()
+		if c.geracoes[chave] == geracao {
+			agora := time.Now()
+			c.podar(agora)
+			c.itens[chave] = cacheItem[T]{valor: valor, expira: agora.Add(ttl)}
+		}
+		c.mu.Unlock()
+		return valor, nil
+	})
+	select {
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	case res := <-ch:
+		valor, _ := res.Val.(T)
+		return valor, res.Err
+	}
+}
+
+// remove os itens expirados, chamado com o mutex travado a cada escrita
+// para as empresas que nao sao mais consultadas nao ficarem na memoria
+func (c *ttlCache[T]) podar(agora time.Time) {
+	for chave, item := range c.itens {
+		if !agora.Before(item.expira) {
+			delete(c.itens, chave)
+		}
+	}
+}
+
+// remove a chave do cache, as buscas das outras chaves continuam valendo
+func (c *ttlCache[T]) invalidar(chave string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.itens, chave)
+	c.geracoes[chave]++
+	c.grupo.Forget(chave)
+}
+
+// o export de setores do SOC traz todas as empresas de uma vez, entao fica no cache uma vez so
+// com os setores indexados pelo codigo da empresa
+const chaveSetores = "todas"
+
+// setores da empresa passando pelo cache
+func buscarSetores(ctx context.Context, empresa string) ([]Setor, error) {
+	porEmpresa, err := setoresCache.get(ctx, chaveSetores, fetchSetoresSOC)
+	if err != nil {
+		return nil, err
+	}
+	return porEmpresa[strings.TrimSpace(empresa)], nil
+}
+
+// hierarquia da empresa passando pelo cache
+func buscarHierarquia(ctx context.Context, empresa string) ([]Cargos_Setores, error) {
+	return hierarquiaCache.get(ctx, empresa, func(ctx context.Context) ([]Cargos_Setores, error) {
+		return fetchHierarquia(ctx, empresa)
+	})
+}
+
+// handler administrativo que descarta o cache da empresa
+func handleInvalidarCache(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r.Context())
+	if campos := camposPreenchidos(r.URL.Query(), "empresa"); len(campos) > 0 {
+		writeError(w, r, newAPIError(http.StatusBadRequest, codigoParametrosInvalidos, "empresa nao preenchida", campos...))
+		return
+	}
+	empresa := r.URL.Query().Get("empresa")
+	hierarquiaCache.invalidar(empresa)
+	// o export de setores é o mesmo para todas as empresas
+	setoresCache.invalidar(chaveSetores)
+	logger.Println("cache invalidado para a empresa", empresa)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"empresa": empresa, "invalidado": []string{"setores", "hierarquia"}})
+}
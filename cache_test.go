@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// inicia a busca da chave no cache e devolve o canal que libera a resposta do SOC
+// e o canal com o resultado do get
+func buscaEmAndamento(c *ttlCache[string], chave, valor string) (chan<- struct{}, <-chan string) {
+	liberar := make(chan struct{})
+	iniciou := make(chan struct{})
+	resultado := make(chan string, 1)
+	go func() {
+		v, _ := c.get(context.Background(), chave, func(context.Context) (string, error) {
+			close(iniciou)
+			<-liberar
+			return valor, nil
+		})
+		resultado <- v
+	}()
+	<-iniciou
+	return liberar, resultado
+}
+
+func TestCacheInvalidarSoDescartaAChave(t *testing.T) {
+	c := newTTLCache[string]("teste", func() time.Duration { return time.Minute })
+
+	liberarA, resultadoA := buscaEmAndamento(c, "A", "setores A antigos")
+	liberarB, resultadoB := buscaEmAndamento(c, "B", "setores B")
+	c.invalidar("A")
+	close(liberarA)
+	close(liberarB)
+	<-resultadoA
+	<-resultadoB
+
+	c.mu.Lock()
+	_, temA := c.itens["A"]
+	_, temB := c.itens["B"]
+	c.mu.Unlock()
+	if temA {
+		t.Error("busca de A iniciada antes da invalidação foi guardada")
+	}
+	if !temB {
+		t.Error("invalidar A descartou a busca de B")
+	}
+
+	// a proxima busca de A depois da invalidação volta a ser guardada
+	v, err := c.get(context.Background(), "A", func(context.Context) (string, error) { return "setores A novos", nil })
+	if err != nil || v != "setores A novos" {
+		t.Fatalf("get A = %q, %v", v, err)
+	}
+	c.mu.Lock()
+	item := c.itens["A"]
+	c.mu.Unlock()
+	if item.valor != "setores A novos" {
+		t.Errorf("A em cache = %q", item.valor)
+	}
+}
+
+func TestCachePodaExpirados(t *testing.T) {
+	c := newTTLCache[string]("teste", func() time.Duration { return time.Minute })
+	c.itens["expirada"] = cacheItem[string]{valor: "antigo", expira: time.Now().Add(-time.Second)}
+	c.itens["valida"] = cacheItem[string]{valor: "atual", expira: time.Now().Add(time.Minute)}
+
+	if _, err := c.get(context.Background(), "nova", func(context.Context) (string, error) { return "novo", nil }); err != nil {
+		t.Fatal(err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.itens["expirada"]; ok {
+		t.Error("item expirado continua no cache depois da escrita")
+	}
+	for _, chave := range []string{"valida", "nova"} {
+		if _, ok := c.itens[chave]; !ok {
+			t.Errorf("chave %s removida do cache", chave)
+		}
+	}
+}
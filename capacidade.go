@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// como os registros do exportadados de uma agenda sao contados
+const (
+	registrosLivres   = "livres"   // cada registro é uma vaga livre no horario
+	registrosOcupados = "ocupados" // cada registro é um agendamento no horario
+)
+
+// regras usadas quando a agenda nao tem regra configurada, iguais as que ficavam fixas no handler:
+// a agenda clientes aceita ate 5 atendimentos e precisa de uma vaga,
+// a agenda Proteger so libera o horario com 2 ou 3 vagas
+func capacidadePadrao(agenda string) RegraCapacidade {
+	if agenda == agendaProteger {
+		return RegraCapacidade{Registros: registrosLivres, MinimoVagas: 2, MaximoVagas: 3}
+	}
+	return RegraCapacidade{Registros: registrosLivres, Capacidade: 5, MinimoVagas: 1}
+}
+
+// regras de capacidade em uso por agenda, montadas no main a partir da configuração
+var regrasCapacidade = map[string]RegraCapacidade{
+	agendaClientes: capacidadePadrao(agendaClientes),
+	agendaProteger: capacidadePadrao(agendaProteger),
+}
+
+// registros livres e ocupados de um horario
+type ocupacao struct {
+	livres   int
+	ocupados int
+}
+
+// valida as regras configuradas e completa as agendas sem regra com as padrao
+func montarCapacidade(regras map[string]RegraCapacidade) (map[string]RegraCapacidade, error) {
+	res := make(map[string]RegraCapacidade)
+	for agenda := range regras {
+		if agenda != agendaClientes && agenda != agendaProteger {
+			return nil, fmt.Errorf("capacidade: agenda desconhecida %q, use %s ou %s", agenda, agendaClientes, agendaProteger)
+		}
+	}
+	for _, agenda := range []string{agendaClientes, agendaProteger} {
+		regra, ok := regras[agenda]
+		if !ok {
+			regra = capacidadePadrao(agenda)
+		}
+		if regra.Registros == "" {
+			regra.Registros = registrosLivres
+		}
+		if regra.MinimoVagas == 0 {
+			regra.MinimoVagas = 1
+		}
+		if err := regra.validar(); err != nil {
+			return nil, fmt.Errorf("capacidade.%s: %w", agenda, err)
+		}
+		res[agenda] = regra
+	}
+	return res, nil
+}
+
+// verifica se os limites da agenda e de cada horario fazem sentido
+func (r RegraCapacidade) validar() error {
+	if r.Registros != registrosLivres && r.Registros != registrosOcupados {
+		return fmt.Errorf("registros deve ser %q ou %q", registrosLivres, registrosOcupados)
+	}
+	for horario := range r.Horarios {
+		if _, err := time.Parse("15:04", horario); err != nil {
+			return fmt.Errorf("horario inválido %q, use HH:MM", horario)
+		}
+	}
+	for _, horario := range append([]string{""}, mapKeys(r.Horarios)...) {
+		capacidade, minimo, maximo := r.limites(horario)
+		onde := ""
+		if horario != "" {
+			onde = " em " + horario
+		}
+		switch {
+		case capacidade < 0 || minimo < 0 || maximo < 0:
+			return fmt.Errorf("limites nao podem ser negativos%s", onde)
+		case r.Registros == registrosOcupados && capacidade == 0:
+			return fmt.Errorf("capacidade é obrigatoria quando os registros sao agendamentos%s", onde)
+		case maximo > 0 && maximo < minimo:
+			return fmt.Errorf("maximo_vagas menor que minimo_vagas%s", onde)
+		}
+	}
+	return nil
+}
+
+// chaves do mapa, a ordem nao importa
+func mapKeys[V any](m map[string]V) []string {
+	chaves := make([]string, 0, len(m))
+	for k := range m {
+		chaves = append(chaves, k)
+	}
+	return chaves
+}
+
+// limites do horario, valores zerados no horario usam os da agenda
+func (r RegraCapacidade) limites(horario string) (capacidade, minimo, maximo int) {
+	capacidade, minimo, maximo = r.Capacidade, r.MinimoVagas, r.MaximoVagas
+	if h, ok := r.Horarios[horario]; ok {
+		if h.Capacidade != 0 {
+			capacidade = h.Capacidade
+		}
+		if h.MinimoVagas != 0 {
+			minimo = h.MinimoVagas
+		}
+		if h.MaximoVagas != 0 {
+			maximo = h.MaximoVagas
+		}
+	}
+	return capacidade, minimo, maximo
+}
+
+// o status do registro conta como ocupado? as listas de status valem primeiro,
+// sem status conhecido vale o tipo de registro da agenda
+func (r RegraCapacidade) ocupado(status string) bool {
+	status = strings.TrimSpace(status)
+	for _, s := range r.StatusOcupados {
+		if strings.EqualFold(s, status) {
+			return true
+		}
+	}
+	for _, s := range r.StatusLivres {
+		if strings.EqualFold(s, status) {
+			return false
+		}
+	}
+	return r.Registros == registrosOcupados
+}
+
+// conta os registros livres e ocupados de cada dia (dd/mm/aaaa) e horario
+func (r RegraCapacidade) contar(registros []Horario) (map[string]map[string]ocupacao, error) {
+	dias := make(map[string]map[string]ocupacao)
+	for _, registro := range registros {
+		dia, err := parseDia(registro.Data)
+		if err != nil {
+			return nil, fmt.Errorf("data inválida na resposta do SOC %q: %w", registro.Data, err)
+		}
+		chave := dia.Format("02/01/2006")
+		if dias[chave] == nil {
+			dias[chave] = make(map[string]ocupacao)
+		}
+		o := dias[chave][registro.Horario]
+		if r.ocupado(registro.Status) {
+			o.ocupados++
+		} else {
+			o.livres++
+		}
+		dias[chave][registro.Horario] = o
+	}
+	return dias, nil
+}
+
+// vagas do horario: os registros livres limitados pela capacidade menos os ocupados,
+// ou so a capacidade menos os ocupados quando os registros sao agendamentos
+func (r RegraCapacidade) vagas(horario string, o ocupacao) int {
+	capacidade, _, _ := r.limites(horario)
+	if capacidade == 0 {
+		return o.livres
+	}
+	restantes := max(capacidade-o.ocupados, 0)
+	if r.Registros == registrosOcupados {
+		return restantes
+	}
+	return min(o.livres, restantes)
+}
+
+// o horario pode ser oferecido quando as vagas estao entre o minimo e o maximo
+func (r RegraCapacidade) aceita(horario string, o ocupacao) bool {
+	vagas := r.vagas(horario, o)
+	_, minimo, maximo := r.limites(horario)
+	return vagas >= minimo && (maximo == 0 || vagas <= maximo)
+}
+
+// soma das vagas dos horarios de trabalho, usada no log
+func (r RegraCapacidade) totalVagas(horarios []string, ocupacoes map[string]ocupacao) int {
+	total := 0
+	for _, horario := range horarios {
+		total += r.vagas(horario, ocupacoes[horario])
+	}
+	return total
+}
+
+// regra em uso da agenda
+func regraAgenda(agenda string) RegraCapacidade {
+	return regrasCapacidade[agenda]
+}
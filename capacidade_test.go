@@ -0,0 +1,158 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMontarCapacidadePadrao(t *testing.T) {
+	regras, err := montarCapacidade(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientes, proteger := regras[agendaClientes], regras[agendaProteger]
+	if clientes.Registros != registrosLivres || clientes.Capacidade != 5 || clientes.MinimoVagas != 1 || clientes.MaximoVagas != 0 {
+		t.Errorf("regra padrao clientes = %+v", clientes)
+	}
+	if proteger.Registros != registrosLivres || proteger.Capacidade != 0 || proteger.MinimoVagas != 2 || proteger.MaximoVagas != 3 {
+		t.Errorf("regra padrao proteger = %+v", proteger)
+	}
+
+	// regra configurada sem registros e minimo usa livres e uma vaga
+	regras, err = montarCapacidade(map[string]RegraCapacidade{agendaProteger: {Capacidade: 4}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := regras[agendaProteger]; p.Registros != registrosLivres || p.MinimoVagas != 1 {
+		t.Errorf("regra proteger completada = %+v", p)
+	}
+	if c := regras[agendaClientes]; c.Capacidade != 5 {
+		t.Errorf("agenda sem regra deveria usar a padrao, veio %+v", c)
+	}
+}
+
+func TestMontarCapacidadeInvalida(t *testing.T) {
+	casos := []struct {
+		nome  string
+		regra map[string]RegraCapacidade
+		erro  string
+	}{
+		{"agenda desconhecida", map[string]RegraCapacidade{"outra": {}}, "agenda desconhecida"},
+		{"registros desconhecido", map[string]RegraCapacidade{agendaClientes: {Registros: "todos"}}, "registros deve ser"},
+		{"ocupados sem capacidade", map[string]RegraCapacidade{agendaClientes: {Registros: registrosOcupados}}, "capacidade é obrigatoria"},
+		{"maximo menor que minimo", map[string]RegraCapacidade{agendaClientes: {MinimoVagas: 3, MaximoVagas: 2}}, "maximo_vagas menor"},
+		{"limite negativo", map[string]RegraCapacidade{agendaClientes: {Capacidade: -1}}, "negativos"},
+		{"horario inválido", map[string]RegraCapacidade{agendaClientes: {Horarios: map[string]LimitesHorario{"8h": {}}}}, "horario inválido"},
+		{"maximo do horario menor que minimo", map[string]RegraCapacidade{agendaClientes: {MinimoVagas: 2, Horarios: map[string]LimitesHorario{"08:00": {MaximoVagas: 1}}}}, "em 08:00"},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			_, err := montarCapacidade(c.regra)
+			if err == nil || !strings.Contains(err.Error(), c.erro) {
+				t.Errorf("montarCapacidade erro = %v, esperava %q", err, c.erro)
+			}
+		})
+	}
+}
+
+func TestVagasEAceita(t *testing.T) {
+	regras, err := montarCapacidade(map[string]RegraCapacidade{
+		agendaClientes: {
+			Registros:  registrosOcupados,
+			Capacidade: 3,
+			Horarios:   map[string]LimitesHorario{"12:00": {Capacidade: 1}, "17:00": {MinimoVagas: 2}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	padrao, err := montarCapacidade(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	casos := []struct {
+		nome    string
+		regra   RegraCapacidade
+		horario string
+		o       ocupacao
+		vagas   int
+		aceita  bool
+	}{
+		// clientes padrao: precisa de uma vaga livre, limitada a 5
+		{"clientes sem vaga", padrao[agendaClientes], "08:00", ocupacao{}, 0, false},
+		{"clientes uma vaga", padrao[agendaClientes], "08:00", ocupacao{livres: 1}, 1, true},
+		{"clientes limitado a 5", padrao[agendaClientes], "08:00", ocupacao{livres: 8}, 5, true},
+		{"clientes livres menos ocupados", padrao[agendaClientes], "08:00", ocupacao{livres: 3, ocupados: 4}, 1, true},
+		{"clientes cheio", padrao[agendaClientes], "08:00", ocupacao{livres: 3, ocupados: 5}, 0, false},
+		// Proteger padrao: so 2 ou 3 vagas
+		{"proteger uma vaga", padrao[agendaProteger], "08:00", ocupacao{livres: 1}, 1, false},
+		{"proteger duas vagas", padrao[agendaProteger], "08:00", ocupacao{livres: 2}, 2, true},
+		{"proteger tres vagas", padrao[agendaProteger], "08:00", ocupacao{livres: 3}, 3, true},
+		{"proteger quatro vagas", padrao[agendaProteger], "08:00", ocupacao{livres: 4}, 4, false},
+		// registros ocupados: vagas sao a capacidade menos os agendamentos
+		{"ocupados vazio", regras[agendaClientes], "08:00", ocupacao{}, 3, true},
+		{"ocupados parcial", regras[agendaClientes], "08:00", ocupacao{ocupados: 2}, 1, true},
+		{"ocupados cheio", regras[agendaClientes], "08:00", ocupacao{ocupados: 3}, 0, false},
+		{"ocupados acima da capacidade", regras[agendaClientes], "08:00", ocupacao{ocupados: 5}, 0, false},
+		// limites do horario
+		{"capacidade do horario", regras[agendaClientes], "12:00", ocupacao{}, 1, true},
+		{"capacidade do horario cheia", regras[agendaClientes], "12:00", ocupacao{ocupados: 1}, 0, false},
+		{"minimo do horario", regras[agendaClientes], "17:00", ocupacao{ocupados: 2}, 1, false},
+		{"minimo do horario atendido", regras[agendaClientes], "17:00", ocupacao{ocupados: 1}, 2, true},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			if got := c.regra.vagas(c.horario, c.o); got != c.vagas {
+				t.Errorf("vagas = %d, esperava %d", got, c.vagas)
+			}
+			if got := c.regra.aceita(c.horario, c.o); got != c.aceita {
+				t.Errorf("aceita = %v, esperava %v", got, c.aceita)
+			}
+		})
+	}
+}
+
+func TestContarStatus(t *testing.T) {
+	regra := RegraCapacidade{
+		Registros:      registrosLivres,
+		StatusOcupados: []string{"AGENDADO", "confirmado"},
+		StatusLivres:   []string{"livre"},
+	}
+	registros := []Horario{
+		{Data: "19/10/2026", Horario: "08:00"},
+		{Data: "19/10/2026", Horario: "08:00", Status: "Agendado"},
+		{Data: "19/10/2026", Horario: "08:00", Status: " CONFIRMADO "},
+		{Data: "19/10/2026", Horario: "08:00", Status: "LIVRE"},
+		{Data: "19/10/2026", Horario: "08:30", Status: "desconhecido"},
+		{Data: "20/10/2026", Horario: "08:00", Status: "agendado"},
+	}
+	dias, err := regra.contar(registros)
+	if err != nil {
+		t.Fatal(err)
+	}
+	esperado := map[string]map[string]ocupacao{
+		"19/10/2026": {"08:00": {livres: 2, ocupados: 2}, "08:30": {livres: 1}},
+		"20/10/2026": {"08:00": {ocupados: 1}},
+	}
+	for dia, horarios := range esperado {
+		for horario, o := range horarios {
+			if got := dias[dia][horario]; got != o {
+				t.Errorf("%s %s = %+v, esperava %+v", dia, horario, got, o)
+			}
+		}
+	}
+
+	// com registros ocupados o status sem lista conta como agendamento
+	regra.Registros = registrosOcupados
+	dias, err = regra.contar(registros)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := dias["19/10/2026"]["08:30"]; got != (ocupacao{ocupados: 1}) {
+		t.Errorf("status desconhecido com registros ocupados = %+v", got)
+	}
+
+	if _, err := regra.contar([]Horario{{Data: "2026-10-19", Horario: "08:00"}}); err == nil {
+		t.Error("esperava erro com data fora do formato do SOC")
+	}
+}
@@ -0,0 +1,25 @@
+// fakesoc sobe o SOC falso em memoria para desenvolvimento e testes de integração.
+//
+//	go run ./cmd/fakesoc -addr :8089
+//	SOC_BASE_URL=http://localhost:8089 go run .
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"sql-connect/internal/fakesoc"
+)
+
+func main() {
+	addr := flag.String("addr", ":8089", "endereço do servidor")
+	fixtures := flag.String("fixtures", "", "arquivo json de fixtures, vazio usa as fixtures padrão")
+	flag.Parse()
+	f, err := fakesoc.LoadFixtures(*fixtures)
+	if err != nil {
+		log.Fatalf("Erro ao carregar fixtures: %v", err)
+	}
+	log.Printf("fakesoc ouvindo em %s, empresa principal %s", *addr, f.EmpresaPrincipal)
+	log.Fatal(http.ListenAndServe(*addr, fakesoc.New(f)))
+}
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// configuração carregada no inicio da aplicação
+var cfg *Config
+
+// estrutura principal de configuração
+type Config struct {
+	Server      ServerConfig               `yaml:"server" toml:"server"`
+	Database    DatabaseConfig             `yaml:"database" toml:"database"`
+	SOC         SOCConfig                  `yaml:"soc" toml:"soc"`
+	Blip        BlipConfig                 `yaml:"blip" toml:"blip"`
+	Auth        AuthConfig                 `yaml:"auth" toml:"auth"`
+	Health      HealthConfig               `yaml:"health" toml:"health"`
+	Tracing     TracingConfig              `yaml:"tracing" toml:"tracing"`
+	Upstream    UpstreamConfig             `yaml:"upstream" toml:"upstream"`
+	Cache       CacheConfig                `yaml:"cache" toml:"cache"`
+	Expediente  ExpedienteConfig           `yaml:"expediente" toml:"expediente"`
+	Agendamento AgendamentoConfig          `yaml:"agendamento" toml:"agendamento"`
+	Capacidade  map[string]RegraCapacidade `yaml:"capacidade" toml:"capacidade"`
+	RotasAgenda RotasAgendaConfig          `yaml:"rotas_agenda" toml:"rotas_agenda"`
+}
+
+// configuração do servidor http
+type ServerConfig struct {
+	Addr            string        `yaml:"addr" toml:"addr"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+// configuração do banco postgres
+type DatabaseConfig struct {
+	DSN          string        `yaml:"dsn" toml:"dsn"`
+	SyncInterval time.Duration `yaml:"sync_interval" toml:"sync_interval"`
+}
+
+// configuração de acesso ao SOC
+type SOCConfig struct {
+	Ambiente    string                 `yaml:"ambiente" toml:"ambiente"`
+	Ambientes   map[string]SOCAmbiente `yaml:"ambientes" toml:"ambientes"`
+	SOCAmbiente `yaml:",inline"`
+}
+
+// endereço e credenciais do SOC, os campos preenchidos em soc.ambientes.<nome>
+// sobrescrevem os de soc quando o ambiente esta ativo
+type SOCAmbiente struct {
+	BaseURL           string             `yaml:"base_url" toml:"base_url"`
+	EmpresaPrincipal  string             `yaml:"empresa_principal" toml:"empresa_principal"`
+	CodigoResponsavel string             `yaml:"codigo_responsavel" toml:"codigo_responsavel"`
+	CodigoUsuario     string             `yaml:"codigo_usuario" toml:"codigo_usuario"`
+	Usuario           string             `yaml:"usuario" toml:"usuario"`
+	Senha             string             `yaml:"senha" toml:"senha"`
+	AgendaClientes    string             `yaml:"agenda_clientes" toml:"agenda_clientes"`
+	AgendaProteger    string             `yaml:"agenda_proteger" toml:"agenda_proteger"`
+	Exportadados      ExportadadosConfig `yaml:"exportadados" toml:"exportadados"`
+}
+
+// credenciais de cada exporta dados do SOC
+type ExportadadosConfig struct {
+	Empresas     ExportaDadosCredencial `yaml:"empresas" toml:"empresas"`
+	Setores      ExportaDadosCredencial `yaml:"setores" toml:"setores"`
+	Hierarquia   ExportaDadosCredencial `yaml:"hierarquia" toml:"hierarquia"`
+	Funcionarios ExportaDadosCredencial `yaml:"funcionarios" toml:"funcionarios"`
+	Agendamentos ExportaDadosCredencial `yaml:"agendamentos" toml:"agendamentos"`
+}
+
+// codigo e chave de um exporta dados
+type ExportaDadosCredencial struct {
+	Codigo string `yaml:"codigo" toml:"codigo"`
+	Chave  string `yaml:"chave" toml:"chave"`
+}
+
+// configuração do Blip usado para buscar os feriados
+type BlipConfig struct {
+	URL string `yaml:"url" toml:"url"`
+	Key string `yaml:"key" toml:"key"`
+}
+
+// configuração da autenticação por jwt do portal, opcional
+type AuthConfig struct {
+	JWKSFile    string `yaml:"jwks_file" toml:"jwks_file"`
+	JWTIssuer   string `yaml:"jwt_issuer" toml:"jwt_issuer"`
+	JWTAudience string `yaml:"jwt_audience" toml:"jwt_audience"`
+}
+
+// configuração do /readyz
+type HealthConfig struct {
+	MaxSyncAge time.Duration `yaml:"max_sync_age" toml:"max_sync_age"`
+	Timeout    time.Duration `yaml:"timeout" toml:"timeout"`
+	SOCProbe   bool          `yaml:"soc_probe" toml:"soc_probe"`
+}
+
+// configuração do tracing com OpenTelemetry
+type TracingConfig struct {
+	Exporter     string  `yaml:"exporter" toml:"exporter"`
+	OTLPEndpoint string  `yaml:"otlp_endpoint" toml:"otlp_endpoint"`
+	ServiceName  string  `yaml:"service_name" toml:"service_name"`
+	SampleRatio  float64 `yaml:"sample_ratio" toml:"sample_ratio"`
+}
+
+// configuração do cliente http usado nas chamadas ao SOC e ao Blip
+type UpstreamConfig struct {
+	ConnectTimeout      time.Duration  `yaml:"connect_timeout" toml:"connect_timeout"`
+	ResponseTimeout     time.Duration  `yaml:"response_timeout" toml:"response_timeout"`
+	Timeout             time.Duration  `yaml:"timeout" toml:"timeout"`
+	MaxIdleConnsPerHost int            `yaml:"max_idle_conns_per_host" toml:"max_idle_conns_per_host"`
+	IdleConnTimeout     time.Duration  `yaml:"idle_conn_timeout" toml:"idle_conn_timeout"`
+	RetryMax            int            `yaml:"retry_max" toml:"retry_max"`
+	RetryBaseDelay      time.Duration  `yaml:"retry_base_delay" toml:"retry_base_delay"`
+	RetryMaxDelay       time.Duration  `yaml:"retry_max_delay" toml:"retry_max_delay"`
+	BreakerFailures     int            `yaml:"breaker_failures" toml:"breaker_failures"`
+	BreakerCooldown     time.Duration  `yaml:"breaker_cooldown" toml:"breaker_cooldown"`
+	Gravacao            GravacaoConfig `yaml:"gravacao" toml:"gravacao"`
+}
+
+// gravação das chamadas externas em disco ou reprodução das gravações, modo vazio desliga
+type GravacaoConfig struct {
+	Modo      string `yaml:"modo" toml:"modo"`
+	Diretorio string `yaml:"diretorio" toml:"diretorio"`
+}
+
+// tempo de vida do cache dos exports do SOC, zero desliga o cache
+type CacheConfig struct {
+	SetoresTTL    time.Duration `yaml:"setores_ttl" toml:"setores_ttl"`
+	HierarquiaTTL time.Duration `yaml:"hierarquia_ttl" toml:"hierarquia_ttl"`
+}
+
+// expediente das agendas: fonte "config" usa so os modelos abaixo, "postgres" usa a tabela
+// expediente e os modelos abaixo para as agendas que nao estao no banco
+type ExpedienteConfig struct {
+	Fonte   string                      `yaml:"fonte" toml:"fonte"`
+	Agendas map[string]ModeloExpediente `yaml:"agendas" toml:"agendas"`
+}
+
+// expediente de uma agenda por dia da semana (dom, seg, ter, qua, qui, sex, sab), dias ausentes ficam fechados
+type ModeloExpediente map[string]JornadaDia
+
+// horario de trabalho de um dia, os horarios começam no inicio a cada duração e precisam terminar ate o fim
+type JornadaDia struct {
+	Inicio  string        `yaml:"inicio" toml:"inicio"`
+	Fim     string        `yaml:"fim" toml:"fim"`
+	Duracao time.Duration `yaml:"duracao" toml:"duracao"`
+	Pausas  []Pausa       `yaml:"pausas" toml:"pausas"`
+}
+
+// intervalo sem atendimento dentro da jornada
+type Pausa struct {
+	Inicio string `yaml:"inicio" toml:"inicio"`
+	Fim    string `yaml:"fim" toml:"fim"`
+}
+
+// regras da consulta de horarios
+type AgendamentoConfig struct {
+	HorizonteDias  int `yaml:"horizonte_dias" toml:"horizonte_dias"`
+	LoteDias       int `yaml:"lote_dias" toml:"lote_dias"`
+	ProximosMaximo int `yaml:"proximos_maximo" toml:"proximos_maximo"`
+}
+
+// regras de capacidade de uma agenda (clientes ou proteger). registros diz se cada registro
+// do exportadados é uma vaga livre ou um agendamento, os status listados mudam essa contagem
+type RegraCapacidade struct {
+	Registros      string                    `yaml:"registros" toml:"registros"`
+	StatusLivres   []string                  `yaml:"status_livres" toml:"status_livres"`
+	StatusOcupados []string                  `yaml:"status_ocupados" toml:"status_ocupados"`
+	Capacidade     int                       `yaml:"capacidade" toml:"capacidade"`
+	MinimoVagas    int                       `yaml:"minimo_vagas" toml:"minimo_vagas"`
+	MaximoVagas    int                       `yaml:"maximo_vagas" toml:"maximo_vagas"`
+	Horarios       map[string]LimitesHorario `yaml:"horarios" toml:"horarios"`
+}
+
+// limites proprios de um horario (HH:MM), valores zerados usam os da agenda
+type LimitesHorario struct {
+	Capacidade  int `yaml:"capacidade" toml:"capacidade"`
+	MinimoVagas int `yaml:"minimo_vagas" toml:"minimo_vagas"`
+	MaximoVagas int `yaml:"maximo_vagas" toml:"maximo_vagas"`
+}
+
+// codigos das agendas no SOC por periodo: fonte "config" usa so as rotas abaixo,
+// "postgres" usa as rotas abaixo e as da tabela rotas_agenda
+type RotasAgendaConfig struct {
+	Fonte string       `yaml:"fonte" toml:"fonte"`
+	Rotas []RotaAgenda `yaml:"rotas" toml:"rotas"`
+}
+
+// codigo de uma agenda (clientes ou proteger) entre inicio e fim (dd/mm/aaaa, inclusos).
+// campos vazios valem para qualquer data, compromisso ou empresa
+type RotaAgenda struct {
+	Agenda      string `yaml:"agenda" toml:"agenda"`
+	Codigo      string `yaml:"codigo" toml:"codigo"`
+	Inicio      string `yaml:"inicio" toml:"inicio"`
+	Fim         string `yaml:"fim" toml:"fim"`
+	Compromisso string `yaml:"compromisso" toml:"compromisso"`
+	Empresa     string `yaml:"empresa" toml:"empresa"`
+}
+
+// campo da configuração que pode vir de variavel de ambiente
+type configField struct {
+	nome        string
+	env         string
+	valor       any
+	obrigatorio bool
+}
+
+// valores padrao da configuração
+func defaultConfig() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:            ":2026",
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Database: DatabaseConfig{
+			SyncInterval: 20 * time.Hour,
+		},
+		SOC: SOCConfig{
+			Ambiente: socAmbienteProducao,
+		},
+		Blip: BlipConfig{
+			URL: "https://clinicaproteger.http.msging.net/commands",
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			ServiceName: "sql-connect",
+			SampleRatio: 1,
+		},
+		Health: HealthConfig{
+			MaxSyncAge: 48 * time.Hour,
+			Timeout:    2 * time.Second,
+		},
+		Upstream: UpstreamConfig{
+			ConnectTimeout:      5 * time.Second,
+			ResponseTimeout:     30 * time.Second,
+			Timeout:             60 * time.Second,
+			MaxIdleConnsPerHost: 10,
+			IdleConnTimeout:     90 * time.Second,
+			RetryMax:            2,
+			RetryBaseDelay:      200 * time.Millisecond,
+			RetryMaxDelay:       2 * time.Second,
+			BreakerFailures:     5,
+			BreakerCooldown:     30 * time.Second,
+		},
+		Cache: CacheConfig{
+			SetoresTTL:    time.Hour,
+			HierarquiaTTL: time.Hour,
+		},
+		Expediente: ExpedienteConfig{
+			Fonte: expedienteFonteConfig,
+		},
+		Agendamento: AgendamentoConfig{
+			HorizonteDias:  30,
+			LoteDias:       7,
+			ProximosMaximo: 20,
+		},
+		RotasAgenda: RotasAgendaConfig{
+			Fonte: expedienteFonteConfig,
+			// agenda usada ate a troca de dezembro de 2024
+			Rotas: []RotaAgenda{{Agenda: agendaClientes, Codigo: "27295", Fim: "30/11/2024"}},
+		},
+	}
+}
+
+// lista de campos da configuração com suas variaveis de ambiente
+func (c *Config) campos() []configField {
+	return []configField{
+		{"server.addr", "SERVER_ADDR", &c.Server.Addr, true},
+		{"server.shutdown_timeout", "SERVER_SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout, true},
+		{"database.dsn", "DATABASE_URL", &c.Database.DSN, true},
+		{"database.sync_interval", "DATABASE_SYNC_INTERVAL", &c.Database.SyncInterval, true},
+		{"soc.ambiente", "SOC_AMBIENTE", &c.SOC.Ambiente, true},
+		{"soc.base_url", "SOC_BASE_URL", &c.SOC.BaseURL, true},
+		{"soc.empresa_principal", "SOC_EMPRESA_PRINCIPAL", &c.SOC.EmpresaPrincipal, true},
+		{"soc.codigo_responsavel", "SOC_CODIGO_RESPONSAVEL", &c.SOC.CodigoResponsavel, true},
+		{"soc.codigo_usuario", "SOC_CODIGO_USUARIO", &c.SOC.CodigoUsuario, true},
+		{"soc.usuario", "SOC_USUARIO", &c.SOC.Usuario, true},
+		{"soc.senha", "SOC_SENHA", &c.SOC.Senha, true},
+		{"soc.agenda_clientes", "SOC_AGENDA_CLIENTES", &c.SOC.AgendaClientes, true},
+		{"soc.agenda_proteger", "SOC_AGENDA_PROTEGER", &c.SOC.AgendaProteger, true},
+		{"soc.exportadados.empresas.codigo", "SOC_EXPORT_EMPRESAS_CODIGO", &c.SOC.Exportadados.Empresas.Codigo, true},
+		{"soc.exportadados.empresas.chave", "SOC_EXPORT_EMPRESAS_CHAVE", &c.SOC.Exportadados.Empresas.Chave, true},
+		{"soc.exportadados.setores.codigo", "SOC_EXPORT_SETORES_CODIGO", &c.SOC.Exportadados.Setores.Codigo, true},
+		{"soc.exportadados.setores.chave", "SOC_EXPORT_SETORES_CHAVE", &c.SOC.Exportadados.Setores.Chave, true},
+		{"soc.exportadados.hierarquia.codigo", "SOC_EXPORT_HIERARQUIA_CODIGO", &c.SOC.Exportadados.Hierarquia.Codigo, true},
+		{"soc.exportadados.hierarquia.chave", "SOC_EXPORT_HIERARQUIA_CHAVE", &c.SOC.Exportadados.Hierarquia.Chave, true},
+		{"soc.exportadados.funcionarios.codigo", "SOC_EXPORT_FUNCIONARIOS_CODIGO", &c.SOC.Exportadados.Funcionarios.Codigo, true},
+		{"soc.exportadados.funcionarios.chave", "SOC_EXPORT_FUNCIONARIOS_CHAVE", &c.SOC.Exportadados.Funcionarios.Chave, true},
+		{"soc.exportadados.agendamentos.codigo", "SOC_EXPORT_AGENDAMENTOS_CODIGO", &c.SOC.Exportadados.Agendamentos.Codigo, true},
+		{"soc.exportadados.agendamentos.chave", "SOC_EXPORT_AGENDAMENTOS_CHAVE", &c.SOC.Exportadados.Agendamentos.Chave, true},
+		{"blip.url", "BLIP_URL", &c.Blip.URL, true},
+		{"blip.key", "BLIP_KEY", &c.Blip.Key, true},
+		{"auth.jwks_file", "AUTH_JWKS_FILE", &c.Auth.JWKSFile, false},
+		{"auth.jwt_issuer", "AUTH_JWT_ISSUER", &c.Auth.JWTIssuer, false},
+		{"auth.jwt_audience", "AUTH_JWT_AUDIENCE", &c.Auth.JWTAudience, false},
+		{"health.max_sync_age", "HEALTH_MAX_SYNC_AGE", &c.Health.MaxSyncAge, true},
+		{"health.timeout", "HEALTH_TIMEOUT", &c.Health.Timeout, true},
+		{"health.soc_probe", "HEALTH_SOC_PROBE", &c.Health.SOCProbe, false},
+		{"tracing.exporter", "TRACING_EXPORTER", &c.Tracing.Exporter, false},
+		{"tracing.otlp_endpoint", "TRACING_OTLP_ENDPOINT", &c.Tracing.OTLPEndpoint, false},
+		{"tracing.service_name", "TRACING_SERVICE_NAME", &c.Tracing.ServiceName, true},
+		{"tracing.sample_ratio", "TRACING_SAMPLE_RATIO", &c.Tracing.SampleRatio, false},
+		{"upstream.connect_timeout", "UPSTREAM_CONNECT_TIMEOUT", &c.Upstream.ConnectTimeout, true},
+		{"upstream.response_timeout", "UPSTREAM_RESPONSE_TIMEOUT", &c.Upstream.ResponseTimeout, true},
+		{"upstream.timeout", "UPSTREAM_TIMEOUT", &c.Upstream.Timeout, true},
+		{"upstream.max_idle_conns_per_host", "UPSTREAM_MAX_IDLE_CONNS_PER_HOST", &c.Upstream.MaxIdleConnsPerHost, true},
+		{"upstream.idle_conn_timeout", "UPSTREAM_IDLE_CONN_TIMEOUT", &c.Upstream.IdleConnTimeout, true},
+		{"upstream.retry_max", "UPSTREAM_RETRY_MAX", &c.Upstream.RetryMax, false},
+		{"upstream.retry_base_delay", "UPSTREAM_RETRY_BASE_DELAY", &c.Upstream.RetryBaseDelay, true},
+		{"upstream.retry_max_delay", "UPSTREAM_RETRY_MAX_DELAY", &c.Upstream.RetryMaxDelay, true},
+		{"upstream.breaker_failures", "UPSTREAM_BREAKER_FAILURES", &c.Upstream.BreakerFailures, true},
+		{"upstream.breaker_cooldown", "UPSTREAM_BREAKER_COOLDOWN", &c.Upstream.BreakerCooldown, true},
+		{"upstream.gravacao.modo", "UPSTREAM_GRAVACAO_MODO", &c.Upstream.Gravacao.Modo, false},
+		{"upstream.gravacao.diretorio", "UPSTREAM_GRAVACAO_DIRETORIO", &c.Upstream.Gravacao.Diretorio, false},
+		{"cache.setores_ttl", "CACHE_SETORES_TTL", &c.Cache.SetoresTTL, false},
+		{"cache.hierarquia_ttl", "CACHE_HIERARQUIA_TTL", &c.Cache.HierarquiaTTL, false},
+		{"expediente.fonte", "EXPEDIENTE_FONTE", &c.Expediente.Fonte, true},
+		{"rotas_agenda.fonte", "ROTAS_AGENDA_FONTE", &c.RotasAgenda.Fonte, true},
+		{"agendamento.horizonte_dias", "AGENDAMENTO_HORIZONTE_DIAS", &c.Agendamento.HorizonteDias, true},
+		{"agendamento.lote_dias", "AGENDAMENTO_LOTE_DIAS", &c.Agendamento.LoteDias, true},
+		{"agendamento.proximos_maximo", "AGENDAMENTO_PROXIMOS_MAXIMO", &c.Agendamento.ProximosMaximo, true},
+	}
+}
+
+// carrega a configuração do arquivo opcional e das variaveis de ambiente
+func loadConfig(path string) (*Config, error) {
+	c := defaultConfig()
+	// o arquivo é opcional, as variaveis de ambiente sobrescrevem ele
+	if path != "" {
+		if err := c.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	// o ambiente do SOC é aplicado antes das variaveis de ambiente para elas continuarem valendo
+	if v, ok := os.LookupEnv("SOC_AMBIENTE"); ok {
+		c.SOC.Ambiente = v
+	}
+	c.aplicarAmbienteSOC()
+	if err := c.loadEnv(); err != nil {
+		return nil, err
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// le o arquivo yaml ou toml de acordo com a extensao
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("erro ao ler arquivo de configuração %s: %w", path, err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, c)
+	case ".toml":
+		err = toml.Unmarshal(data, c)
+	default:
+		return fmt.Errorf("extensão do arquivo de configuração não suportada: %s", path)
+	}
+	if err != nil {
+		return fmt.Errorf("erro ao interpretar arquivo de configuração %s: %w", path, err)
+	}
+	return nil
+}
+
+// sobrescreve os campos com as variaveis de ambiente definidas
+func (c *Config) loadEnv() error {
+	var errs []error
+	for _, campo := range c.campos() {
+		v, ok := os.LookupEnv(campo.env)
+		if !ok {
+			continue
+		}
+		if err := setConfigValue(campo.valor, v); err != nil {
+			errs = append(errs, fmt.Errorf("%s (%s): %w", campo.nome, campo.env, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// converte o texto da variavel de ambiente para o tipo do campo
+func setConfigValue(dst any, v string) error {
+	switch p := dst.(type) {
+	case *string:
+		*p = v
+	case *int:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("número inválido %q", v)
+		}
+		*p = n
+	case *bool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("booleano inválido %q", v)
+		}
+		*p = b
+	case *float64:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("número inválido %q", v)
+		}
+		*p = f
+	case *time.Duration:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("duração inválida %q", v)
+		}
+		*p = d
+	default:
+		return fmt.Errorf("tipo de campo não suportado %T", dst)
+	}
+	return nil
+}
+
+// verifica se o campo esta vazio
+func isZeroConfigValue(v any) bool {
+	switch p := v.(type) {
+	case *string:
+		return strings.TrimSpace(*p) == ""
+	case *int:
+		return *p == 0
+	case *time.Duration:
+		return *p == 0
+	}
+	return false
+}
+
+// valida a configuração e junta todos os erros encontrados
+func (c *Config) validate() error {
+	var errs []error
+	for _, campo := range c.campos() {
+		if campo.obrigatorio && isZeroConfigValue(campo.valor) {
+			errs = append(errs, fmt.Errorf("%s (%s) é obrigatório", campo.nome, campo.env))
+		}
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("tracing.sample_ratio deve estar entre 0 e 1"))
+	}
+	if c.Upstream.RetryMax < 0 {
+		errs = append(errs, fmt.Errorf("upstream.retry_max não pode ser negativo"))
+	}
+	if c.Upstream.RetryBaseDelay < 0 {
+		errs = append(errs, fmt.Errorf("upstream.retry_base_delay não pode ser negativo"))
+	}
+	if c.Upstream.RetryMaxDelay < 0 {
+		errs = append(errs, fmt.Errorf("upstream.retry_max_delay não pode ser negativo"))
+	}
+	if err := c.validarAmbienteSOC(); err != nil {
+		errs = append(errs, err)
+	}
+	switch c.Upstream.Gravacao.Modo {
+	case "":
+	case gravacaoGravar, gravacaoReproduzir:
+		if strings.TrimSpace(c.Upstream.Gravacao.Diretorio) == "" {
+			errs = append(errs, fmt.Errorf("upstream.gravacao.diretorio (UPSTREAM_GRAVACAO_DIRETORIO) é obrigatório com upstream.gravacao.modo"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("upstream.gravacao.modo deve ser %q ou %q", gravacaoGravar, gravacaoReproduzir))
+	}
+	if c.Expediente.Fonte != expedienteFonteConfig && c.Expediente.Fonte != expedienteFontePostgres {
+		errs = append(errs, fmt.Errorf("expediente.fonte deve ser %q ou %q", expedienteFonteConfig, expedienteFontePostgres))
+	}
+	if _, err := montarExpediente(c.Expediente.Agendas); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := montarCapacidade(c.Capacidade); err != nil {
+		errs = append(errs, err)
+	}
+	if c.RotasAgenda.Fonte != expedienteFonteConfig && c.RotasAgenda.Fonte != expedienteFontePostgres {
+		errs = append(errs, fmt.Errorf("rotas_agenda.fonte deve ser %q ou %q", expedienteFonteConfig, expedienteFontePostgres))
+	}
+	if _, err := montarRotas(c.RotasAgenda.Rotas); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Agendamento.HorizonteDias < 0 {
+		errs = append(errs, fmt.Errorf("agendamento.horizonte_dias não pode ser negativo"))
+	}
+	if c.Agendamento.LoteDias < 1 {
+		errs = append(errs, fmt.Errorf("agendamento.lote_dias deve ser maior que zero"))
+	}
+	if c.Agendamento.ProximosMaximo < 1 {
+		errs = append(errs, fmt.Errorf("agendamento.proximos_maximo deve ser maior que zero"))
+	}
+	if c.Database.SyncInterval < 0 {
+		errs = append(errs, fmt.Errorf("database.sync_interval não pode ser negativo"))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("configuração inválida:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
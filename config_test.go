@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateAtrasosDeRetry(t *testing.T) {
+	casos := []struct {
+		nome    string
+		alterar func(*Config)
+		erro    string
+	}{
+		{"base negativa", func(c *Config) { c.Upstream.RetryBaseDelay = -time.Millisecond }, "upstream.retry_base_delay não pode ser negativo"},
+		{"maximo negativo", func(c *Config) { c.Upstream.RetryMaxDelay = -time.Millisecond }, "upstream.retry_max_delay não pode ser negativo"},
+		{"base zerada", func(c *Config) { c.Upstream.RetryBaseDelay = 0 }, "upstream.retry_base_delay (UPSTREAM_RETRY_BASE_DELAY) é obrigatório"},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			cfg := defaultConfig()
+			cfg.Database.DSN = "postgres://teste"
+			cfg.SOC.Ambiente = socAmbienteLocal
+			cfg.aplicarAmbienteSOC()
+			cfg.Blip.URL = "http://blip"
+			cfg.Blip.Key = "teste"
+			if err := cfg.validate(); err != nil {
+				t.Fatalf("configuração base inválida: %v", err)
+			}
+			c.alterar(cfg)
+			if err := cfg.validate(); err == nil || !strings.Contains(err.Error(), c.erro) {
+				t.Errorf("validate = %v, esperava %q", err, c.erro)
+			}
+		})
+	}
+}
+
+// o exemplo reproduz o expediente e as regras de vaga padrao, extras ficam so comentados
+func TestConfigExemploIgualAoPadrao(t *testing.T) {
+	c := defaultConfig()
+	if err := c.loadFile("config.example.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	exemplo, err := montarExpediente(c.Expediente.Agendas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	padrao, err := montarExpediente(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, agenda := range []string{agendaClientes, agendaProteger} {
+		for dia := time.Sunday; dia <= time.Saturday; dia++ {
+			j, ok := exemplo[agenda][dia]
+			jp, okp := padrao[agenda][dia]
+			if ok != okp {
+				t.Errorf("%s %s: aberto no exemplo %v, no padrao %v", agenda, dia, ok, okp)
+				continue
+			}
+			if ok && !slices.Equal(j.horarios(), jp.horarios()) {
+				t.Errorf("%s %s: exemplo %v, padrao %v", agenda, dia, j.horarios(), jp.horarios())
+			}
+		}
+	}
+
+	regrasExemplo, err := montarCapacidade(c.Capacidade)
+	if err != nil {
+		t.Fatal(err)
+	}
+	regrasPadrao, err := montarCapacidade(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, agenda := range []string{agendaClientes, agendaProteger} {
+		for _, horario := range jornadaCompleta() {
+			for livres := 0; livres <= 6; livres++ {
+				o := ocupacao{livres: livres}
+				if got, want := regrasExemplo[agenda].aceita(horario, o), regrasPadrao[agenda].aceita(horario, o); got != want {
+					t.Errorf("%s %s com %d livres: exemplo aceita %v, padrao %v", agenda, horario, livres, got, want)
+				}
+			}
+		}
+	}
+}
+
+// horarios de 30 em 30 minutos das 07:30 as 16:30
+func jornadaCompleta() []string {
+	var horarios []string
+	for m := 7*60 + 30; m < 17*60; m += 30 {
+		horarios = append(horarios, fmt.Sprintf("%02d:%02d", m/60, m%60))
+	}
+	return horarios
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// os feriados do Blip nao puderam ser consultados. a regra vale para a consulta de um dia,
+// do periodo, dos proximos horarios e para o agendamento: sem a lista de feriados a consulta
+// falha com este erro junto com os das agendas, um feriado nunca é tratado como dia livre
+var ErrFeriadosIndisponiveis = errors.New("feriados indisponíveis no Blip")
+
+// erro da busca dos feriados marcado com ErrFeriadosIndisponiveis
+func erroFeriados(err error) error {
+	return fmt.Errorf("%w: %w", ErrFeriadosIndisponiveis, err)
+}
+
+// agendamentos das duas agendas e feriado de um dia
+type consultaDia struct {
+	clientes []Horario
+	proteger []Horario
+	feriado  bool
+}
+
+// dia com os horarios livres na consulta por periodo
+type DiaDisponivel struct {
+	Data     string   `json:"data"`
+	Horarios []string `json:"horarios"`
+}
+
+// busca as duas agendas no periodo ao mesmo tempo, com uma chamada ao exportadados por agenda
+func buscarAgendas(ctx context.Context, inicio, fim time.Time, filtro filtroAgenda) (clientes, proteger []Horario, err error) {
+	var (
+		errs [2]error
+		wg   sync.WaitGroup
+	)
+	buscar := func(i int, nome string, buscarAgenda func(context.Context, time.Time, time.Time, filtroAgenda) ([]byte, error), destino *[]Horario) {
+		defer wg.Done()
+		body, err := buscarAgenda(ctx, inicio, fim, filtro)
+		if err != nil {
+			errs[i] = fmt.Errorf("agenda %s: %w", nome, err)
+			return
+		}
+		if err := json.Unmarshal(body, destino); err != nil {
+			errs[i] = fmt.Errorf("agenda %s: resposta do SOC em formato inesperado: %w", nome, err)
+		}
+	}
+	wg.Add(2)
+	go buscar(0, "clientes", getAgendamento, &clientes)
+	go buscar(1, "Proteger", getAgendaProteger, &proteger)
+	wg.Wait()
+	if err := errors.Join(errs[:]...); err != nil {
+		return nil, nil, err
+	}
+	return clientes, proteger, nil
+}
+
+// busca as duas agendas e o feriado do dia ao mesmo tempo, quando o dia é feriado
+// as buscas das agendas sao canceladas e os erros delas descartados.
+// sem o feriado vale ErrFeriadosIndisponiveis
+func consultarDia(ctx context.Context, dia time.Time, filtro filtroAgenda) (consultaDia, error) {
+	ctxAgendas, cancelar := context.WithCancel(ctx)
+	defer cancelar()
+	var (
+		res         consultaDia
+		err         error
+		errFeriados error
+		wg          sync.WaitGroup
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		res.clientes, res.proteger, err = buscarAgendas(ctxAgendas, dia, dia, filtro)
+	}()
+	go func() {
+		defer wg.Done()
+		feriado, errHoliday := isHoliday(ctx, dia)
+		if errHoliday != nil {
+			errFeriados = erroFeriados(errHoliday)
+			return
+		}
+		if feriado {
+			res.feriado = true
+			cancelar()
+		}
+	}()
+	wg.Wait()
+	if res.feriado {
+		return consultaDia{feriado: true}, nil
+	}
+	if err := errors.Join(err, errFeriados); err != nil {
+		return consultaDia{}, err
+	}
+	return res, nil
+}
+
+// o horario esta livre quando as regras de capacidade das duas agendas aceitam
+func horarioDisponivel(horario string, clientes, proteger map[string]ocupacao) bool {
+	return regraAgenda(agendaClientes).aceita(horario, clientes[horario]) && regraAgenda(agendaProteger).aceita(horario, proteger[horario])
+}
+
+// horarios livres da grade de trabalho no dia, pula os horarios que ja passaram
+func horariosLivresDia(dia time.Time, horariosTrabalho []string, clientes, proteger map[string]ocupacao, agora time.Time) []string {
+	livres := []string{}
+	for _, horario := range horariosTrabalho {
+		if horarioPassado(dia, horario, agora) {
+			continue
+		}
+		if horarioDisponivel(horario, clientes, proteger) {
+			livres = append(livres, horario)
+		}
+	}
+	return livres
+}
+
+// horarios livres de cada dia do periodo, dias sem expediente e feriados ficam de fora.
+// as agendas e os feriados sao buscados uma vez so para o periodo inteiro
+func consultarPeriodo(ctx context.Context, inicio, fim, agora time.Time, filtro filtroAgenda) ([]DiaDisponivel, error) {
+	var (
+		clientes, proteger []Horario
+		feriados           [][2]time.Time
+		err, errFeriados   error
+		wg                 sync.WaitGroup
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		clientes, proteger, err = buscarAgendas(ctx, inicio, fim, filtro)
+	}()
+	go func() {
+		defer wg.Done()
+		var errBlip error
+		feriados, errBlip = getFeriados(ctx, attribute.String("feriado.inicio", socData(inicio)), attribute.String("feriado.fim", socData(fim)))
+		if errBlip != nil {
+			errFeriados = erroFeriados(errBlip)
+		}
+	}()
+	wg.Wait()
+	// sem a lista de feriados vale ErrFeriadosIndisponiveis, como na consulta de um dia
+	if err := errors.Join(err, errFeriados); err != nil {
+		return nil, err
+	}
+	vagasClientes, err := regraAgenda(agendaClientes).contar(clientes)
+	if err != nil {
+		return nil, err
+	}
+	vagasProteger, err := regraAgenda(agendaProteger).contar(proteger)
+	if err != nil {
+		return nil, err
+	}
+	dias := []DiaDisponivel{}
+	for dia := inicio; !dia.After(fim); dia = dia.AddDate(0, 0, 1) {
+		horariosTrabalho := horariosTrabalhoDia(dia.Weekday())
+		if len(horariosTrabalho) == 0 || isDateInIntervals(dia, feriados) {
+			continue
+		}
+		data := dia.Format("02/01/2006")
+		dias = append(dias, DiaDisponivel{
+			Data:     data,
+			Horarios: horariosLivresDia(dia, horariosTrabalho, vagasClientes[data], vagasProteger[data], agora),
+		})
+	}
+	return dias, nil
+}
+
+// a empresa do filtro escolhe agendas dedicadas a ela, entao o token precisa poder acessar a empresa.
+// responde o erro e retorna false quando nao pode
+func autorizarFiltroAgenda(w http.ResponseWriter, r *http.Request, filtro filtroAgenda) bool {
+	if filtro.empresa == "" {
+		return true
+	}
+	if status, err := autorizarEmpresa(principalFrom(r.Context()), filtro.empresa); err != nil {
+		requestLogger(r.Context()).Println("empresa não autorizada:", err)
+		writeError(w, r, newAPIError(status, codigoEmpresaNaoAutorizada, "empresa não autorizada"))
+		return false
+	}
+	return true
+}
+
+// quantidade de horarios devolvida pelo GET /agendamento/proximos sem o parametro quantidade
+const proximosPadrao = 5
+
+// primeiros horarios livres a partir de inicio ate o limite. os dias sao consultados em lotes de
+// agendamento.lote_dias, com uma chamada por agenda ao exportadados em cada lote, e a busca para
+// no primeiro lote que completa a quantidade
+func proximosHorarios(ctx context.Context, inicio, limite, agora time.Time, quantidade int, filtro filtroAgenda) ([]Horario, error) {
+	horarios := []Horario{}
+	for lote := inicio; !lote.After(limite); lote = lote.AddDate(0, 0, cfg.Agendamento.LoteDias) {
+		fimLote := lote.AddDate(0, 0, cfg.Agendamento.LoteDias-1)
+		if fimLote.After(limite) {
+			fimLote = limite
+		}
+		dias, err := consultarPeriodo(ctx, lote, fimLote, agora, filtro)
+		if err != nil {
+			return nil, err
+		}
+		for _, dia := range dias {
+			for _, horario := range dia.Horarios {
+				horarios = append(horarios, Horario{Data: dia.Data, Horario: horario})
+				if len(horarios) == quantidade {
+					return horarios, nil
+				}
+			}
+		}
+	}
+	return horarios, nil
+}
+
+// GET /agendamento/proximos: primeiros horarios livres a partir de data (hoje quando vazia)
+func handleProximosHorarios(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r.Context())
+	q := r.URL.Query()
+	spanAttrs(r.Context(),
+		attribute.String("agendamento.data", q.Get("data")),
+		attribute.String("agendamento.quantidade", q.Get("quantidade")),
+	)
+	quantidade := proximosPadrao
+	if q.Get("quantidade") != "" {
+		n, err := strconv.Atoi(q.Get("quantidade"))
+		if err != nil || n < 1 || n > cfg.Agendamento.ProximosMaximo {
+			writeError(w, r, newAPIError(http.StatusBadRequest, codigoParametrosInvalidos, "quantidade inválida",
+				CampoErro{Campo: "quantidade", Mensagem: fmt.Sprintf("use um numero de 1 a %d", cfg.Agendamento.ProximosMaximo)}))
+			return
+		}
+		quantidade = n
+	}
+	// hora atual e inicio do dia no fuso de Sao Paulo
+	agora := agoraSaoPaulo()
+	hoje := inicioDoDia(agora)
+	inicio := hoje
+	if q.Get("data") != "" {
+		dia, err := parseDia(q.Get("data"))
+		if err != nil {
+			logger.Printf("Formato de data inválido: %v\n", err)
+			writeError(w, r, newAPIError(http.StatusBadRequest, codigoDataInvalida, "formato de data inválido, use dd/mm/aaaa",
+				CampoErro{Campo: "data", Mensagem: "use o formato dd/mm/aaaa"}))
+			return
+		}
+		// dias que ja passaram ficam de fora
+		if dia.After(hoje) {
+			inicio = dia
+		}
+	}
+	limite := hoje.AddDate(0, 0, cfg.Agendamento.HorizonteDias)
+	if inicio.After(limite) {
+		writeError(w, r, newAPIError(http.StatusBadRequest, codigoPeriodoInvalido,
+			fmt.Sprintf("data fora do horizonte de agendamento de %d dias a partir de hoje", cfg.Agendamento.HorizonteDias)))
+		return
+	}
+	filtro := filtroAgenda{compromisso: q.Get("compromisso"), empresa: q.Get("empresa")}
+	if !autorizarFiltroAgenda(w, r, filtro) {
+		return
+	}
+	horarios, err := proximosHorarios(r.Context(), inicio, limite, agora, quantidade, filtro)
+	if err != nil {
+		logger.Println("Erro ao buscar os agendamentos no SOC:", err)
+		writeError(w, r, socError(err, "erro ao buscar os agendamentos no SOC"))
+		return
+	}
+	logger.Printf("%d horarios livres encontrados a partir de %s", len(horarios), socData(inicio))
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(horarios); err != nil {
+		logger.Printf("Erro ao retornar horários: %v", err)
+	}
+}
+
+// GET /agendamento com inicio e fim: horarios livres agrupados por dia
+func handleDisponibilidadePeriodo(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r.Context())
+	q := r.URL.Query()
+	spanAttrs(r.Context(),
+		attribute.String("agendamento.inicio", q.Get("inicio")),
+		attribute.String("agendamento.fim", q.Get("fim")),
+	)
+	inicio, err := parseDia(q.Get("inicio"))
+	if err != nil {
+		logger.Printf("Formato de data inválido: %v\n", err)
+		writeError(w, r, newAPIError(http.StatusBadRequest, codigoDataInvalida, "formato de data inválido, use dd/mm/aaaa",
+			CampoErro{Campo: "inicio", Mensagem: "use o formato dd/mm/aaaa"}))
+		return
+	}
+	// sem fim a consulta é so do dia de inicio
+	fim := inicio
+	if q.Get("fim") != "" {
+		fim, err = parseDia(q.Get("fim"))
+		if err != nil {
+			logger.Printf("Formato de data inválido: %v\n", err)
+			writeError(w, r, newAPIError(http.StatusBadRequest, codigoDataInvalida, "formato de data inválido, use dd/mm/aaaa",
+				CampoErro{Campo: "fim", Mensagem: "use o formato dd/mm/aaaa"}))
+			return
+		}
+	}
+	if fim.Before(inicio) {
+		writeError(w, r, newAPIError(http.StatusBadRequest, codigoPeriodoInvalido, "fim do periodo antes do inicio",
+			CampoErro{Campo: "fim", Mensagem: "deve ser igual ou depois do inicio"}))
+		return
+	}
+	// hora atual e inicio do dia no fuso de Sao Paulo
+	agora := agoraSaoPaulo()
+	hoje := inicioDoDia(agora)
+	// dias que ja passaram ficam de fora e o fim é limitado ao horizonte de agendamento
+	if inicio.Before(hoje) {
+		inicio = hoje
+	}
+	limite := hoje.AddDate(0, 0, cfg.Agendamento.HorizonteDias)
+	if fim.After(limite) {
+		logger.Printf("fim do periodo limitado ao horizonte de %d dias: %s", cfg.Agendamento.HorizonteDias, socData(limite))
+		fim = limite
+	}
+	if inicio.After(fim) {
+		writeError(w, r, newAPIError(http.StatusBadRequest, codigoPeriodoInvalido,
+			fmt.Sprintf("periodo fora do horizonte de agendamento de %d dias a partir de hoje", cfg.Agendamento.HorizonteDias)))
+		return
+	}
+	filtro := filtroAgenda{compromisso: q.Get("compromisso"), empresa: q.Get("empresa")}
+	if !autorizarFiltroAgenda(w, r, filtro) {
+		return
+	}
+	dias, err := consultarPeriodo(r.Context(), inicio, fim, agora, filtro)
+	if err != nil {
+		logger.Println("Erro ao buscar os agendamentos no SOC:", err)
+		writeError(w, r, socError(err, "erro ao buscar os agendamentos no SOC"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(dias); err != nil {
+		logger.Printf("Erro ao retornar horários: %v", err)
+	}
+}
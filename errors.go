@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// codigos de erro estaveis devolvidos para os integradores
+const (
+	codigoNaoAutorizado        = "nao_autorizado"
+	codigoAcessoNegado         = "acesso_negado"
+	codigoEmpresaNaoAutorizada = "empresa_nao_autorizada"
+	codigoMetodoNaoSuportado   = "metodo_nao_suportado"
+	codigoParametrosInvalidos  = "parametros_invalidos"
+	codigoCorpoInvalido        = "corpo_invalido"
+	codigoDataInvalida         = "data_invalida"
+	codigoPeriodoInvalido      = "periodo_invalido"
+	codigoFimDeSemana          = "fim_de_semana"
+	codigoDiaSemExpediente     = "dia_sem_expediente"
+	codigoFeriado              = "feriado"
+	codigoDiaPassado           = "dia_passado"
+	codigoHorarioIndisponivel  = "horario_indisponivel"
+	codigoNaoEncontrado        = "nao_encontrado"
+	codigoErroSOC              = "erro_soc"
+	codigoSOCIndisponivel      = "soc_indisponivel"
+	codigoSOCCredenciais       = "soc_credenciais_invalidas"
+	codigoSOCLimite            = "soc_limite_excedido"
+	codigoErroInterno          = "erro_interno"
+)
+
+// erro devolvido por todos os endpoints
+type APIError struct {
+	Status    int         `json:"-"`
+	Codigo    string      `json:"codigo"`
+	Mensagem  string      `json:"mensagem"`
+	RequestID string      `json:"request_id,omitempty"`
+	Campos    []CampoErro `json:"campos,omitempty"`
+}
+
+// erro de um campo especifico da requisição
+type CampoErro struct {
+	Campo    string `json:"campo"`
+	Mensagem string `json:"mensagem"`
+}
+
+func (e *APIError) Error() string {
+	return e.Codigo + ": " + e.Mensagem
+}
+
+// cria o erro com o status http, o codigo e a mensagem para o usuario
+func newAPIError(status int, codigo, mensagem string, campos ...CampoErro) *APIError {
+	return &APIError{Status: status, Codigo: codigo, Mensagem: mensagem, Campos: campos}
+}
+
+// escreve o erro em json com o id da requisição
+func writeError(w http.ResponseWriter, r *http.Request, e *APIError) {
+	e.RequestID = requestIDFrom(r.Context())
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(e.Status)
+	json.NewEncoder(w).Encode(e)
+}
+
+// erro de autenticação/autorização a partir do status devolvido pelo autorizar
+func authError(status int) *APIError {
+	switch status {
+	case http.StatusUnauthorized:
+		return newAPIError(status, codigoNaoAutorizado, "não autorizado")
+	case http.StatusForbidden:
+		return newAPIError(status, codigoAcessoNegado, "sem permissão para acessar este recurso")
+	default:
+		return newAPIError(http.StatusInternalServerError, codigoErroInterno, "erro ao verificar a autenticação")
+	}
+}
+
+// erro de uma chamada ao SOC de acordo com o tipo do erro, a mensagem é usada nas falhas genericas
+func socError(err error, mensagem string) *APIError {
+	switch {
+	case errors.Is(err, ErrCircuitoAberto):
+		return newAPIError(http.StatusServiceUnavailable, codigoSOCIndisponivel, "SOC indisponível no momento, tente novamente em instantes")
+	case errors.Is(err, ErrSOCNaoEncontrado):
+		return newAPIError(http.StatusNotFound, codigoNaoEncontrado, "registro não encontrado no SOC")
+	case errors.Is(err, ErrSOCCredenciais):
+		return newAPIError(http.StatusBadGateway, codigoSOCCredenciais, "o SOC recusou as credenciais de integração")
+	case errors.Is(err, ErrSOCLimite):
+		return newAPIError(http.StatusServiceUnavailable, codigoSOCLimite, "limite de consultas do SOC excedido, tente novamente mais tarde")
+	case errors.Is(err, ErrFeriadosIndisponiveis):
+		return newAPIError(http.StatusBadGateway, codigoErroSOC, "não foi possível consultar os feriados, tente novamente em instantes")
+	}
+	return newAPIError(http.StatusBadGateway, codigoErroSOC, mensagem)
+}
+
+// lista os parametros obrigatorios que nao vieram na query, parametro vazio (?empresa=) conta como presente
+func camposObrigatorios(q url.Values, nomes ...string) []CampoErro {
+	var campos []CampoErro
+	for _, nome := range nomes {
+		if !q.Has(nome) {
+			campos = append(campos, CampoErro{Campo: nome, Mensagem: "parâmetro obrigatório"})
+		}
+	}
+	return campos
+}
+
+// lista os parametros obrigatorios que nao vieram ou vieram vazios
+func camposPreenchidos(q url.Values, nomes ...string) []CampoErro {
+	var campos []CampoErro
+	for _, nome := range nomes {
+		if q.Get(nome) == "" {
+			campos = append(campos, CampoErro{Campo: nome, Mensagem: "parâmetro obrigatório"})
+		}
+	}
+	return campos
+}
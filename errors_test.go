@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func TestCamposObrigatoriosEPreenchidos(t *testing.T) {
+	casos := []struct {
+		nome         string
+		query        string
+		obrigatorios []string
+		preenchidos  []string
+	}{
+		{"todos preenchidos", "cpf=123&empresa=100", nil, nil},
+		{"empresa vazia conta como presente", "cpf=123&empresa=", nil, []string{"empresa"}},
+		{"empresa ausente", "cpf=123", []string{"empresa"}, []string{"empresa"}},
+		{"nenhum", "", []string{"cpf", "empresa"}, []string{"cpf", "empresa"}},
+	}
+	nomesCampos := func(campos []CampoErro) []string {
+		var nomes []string
+		for _, c := range campos {
+			nomes = append(nomes, c.Campo)
+		}
+		return nomes
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			q, err := url.ParseQuery(c.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := nomesCampos(camposObrigatorios(q, "cpf", "empresa")); !slices.Equal(got, c.obrigatorios) {
+				t.Errorf("camposObrigatorios = %v, esperava %v", got, c.obrigatorios)
+			}
+			if got := nomesCampos(camposPreenchidos(q, "cpf", "empresa")); !slices.Equal(got, c.preenchidos) {
+				t.Errorf("camposPreenchidos = %v, esperava %v", got, c.preenchidos)
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// agendas do SOC que tem modelo de expediente
+const (
+	agendaClientes = "clientes"
+	agendaProteger = "proteger"
+)
+
+// de onde vem os modelos de expediente
+const (
+	expedienteFonteConfig   = "config"
+	expedienteFontePostgres = "postgres"
+)
+
+// nomes dos dias da semana usados na configuração
+var diasSemana = map[string]time.Weekday{
+	"dom": time.Sunday,
+	"seg": time.Monday,
+	"ter": time.Tuesday,
+	"qua": time.Wednesday,
+	"qui": time.Thursday,
+	"sex": time.Friday,
+	"sab": time.Saturday,
+}
+
+// expediente usado quando a agenda nao tem modelo configurado:
+// segunda a sexta das 07:30 as 17:00 com horarios de 30 minutos
+func expedientePadrao() ModeloExpediente {
+	j := JornadaDia{Inicio: "07:30", Fim: "17:00", Duracao: 30 * time.Minute}
+	return ModeloExpediente{"seg": j, "ter": j, "qua": j, "qui": j, "sex": j}
+}
+
+// jornada de um dia convertida em minutos desde a meia-noite
+type jornada struct {
+	inicio  int
+	fim     int
+	duracao int
+	pausas  [][2]int
+}
+
+// expediente em uso por agenda e dia da semana, dias ausentes ficam fechados
+var expedientes struct {
+	mu      sync.RWMutex
+	agendas map[string]map[time.Weekday]jornada
+}
+
+// converte "HH:MM" em minutos desde a meia-noite
+func minutosDoDia(hhmm string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(hhmm))
+	if err != nil {
+		return 0, fmt.Errorf("horario inválido %q, use HH:MM", hhmm)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// valida a jornada configurada e converte para minutos
+func parseJornada(j JornadaDia) (jornada, error) {
+	var res jornada
+	var err error
+	if res.inicio, err = minutosDoDia(j.Inicio); err != nil {
+		return res, err
+	}
+	if res.fim, err = minutosDoDia(j.Fim); err != nil {
+		return res, err
+	}
+	if res.fim <= res.inicio {
+		return res, fmt.Errorf("fim %s deve ser depois do inicio %s", j.Fim, j.Inicio)
+	}
+	if j.Duracao < time.Minute || j.Duracao%time.Minute != 0 {
+		return res, fmt.Errorf("duração %s inválida, use minutos inteiros", j.Duracao)
+	}
+	res.duracao = int(j.Duracao / time.Minute)
+	for _, p := range j.Pausas {
+		inicio, err := minutosDoDia(p.Inicio)
+		if err != nil {
+			return res, err
+		}
+		fim, err := minutosDoDia(p.Fim)
+		if err != nil {
+			return res, err
+		}
+		if fim <= inicio {
+			return res, fmt.Errorf("pausa %s-%s termina antes de começar", p.Inicio, p.Fim)
+		}
+		res.pausas = append(res.pausas, [2]int{inicio, fim})
+	}
+	return res, nil
+}
+
+// horarios de inicio da jornada, cada horario precisa caber inteiro antes do fim e fora das pausas
+func (j jornada) horarios() []string {
+	var horarios []string
+	for t := j.inicio; t+j.duracao <= j.fim; t += j.duracao {
+		if j.emPausa(t) {
+			continue
+		}
+		horarios = append(horarios, fmt.Sprintf("%02d:%02d", t/60, t%60))
+	}
+	return horarios
+}
+
+// verifica se o horario que começa em t encosta em alguma pausa
+func (j jornada) emPausa(t int) bool {
+	for _, p := range j.pausas {
+		if t < p[1] && t+j.duracao > p[0] {
+			return true
+		}
+	}
+	return false
+}
+
+// monta o expediente de cada agenda, agendas sem modelo usam o padrao
+func montarExpediente(modelos map[string]ModeloExpediente) (map[string]map[time.Weekday]jornada, error) {
+	res := make(map[string]map[time.Weekday]jornada)
+	for _, agenda := range []string{agendaClientes, agendaProteger} {
+		modelo, ok := modelos[agenda]
+		if !ok {
+			modelo = expedientePadrao()
+		}
+		dias := make(map[time.Weekday]jornada)
+		for nome, j := range modelo {
+			dia, ok := diasSemana[strings.ToLower(nome)]
+			if !ok {
+				return nil, fmt.Errorf("expediente.agendas.%s: dia da semana desconhecido %q, use dom, seg, ter, qua, qui, sex ou sab", agenda, nome)
+			}
+			jor, err := parseJornada(j)
+			if err != nil {
+				return nil, fmt.Errorf("expediente.agendas.%s.%s: %w", agenda, nome, err)
+			}
+			dias[dia] = jor
+		}
+		res[agenda] = dias
+	}
+	for agenda := range modelos {
+		if agenda != agendaClientes && agenda != agendaProteger {
+			return nil, fmt.Errorf("expediente.agendas: agenda desconhecida %q, use %s ou %s", agenda, agendaClientes, agendaProteger)
+		}
+	}
+	return res, nil
+}
+
+// horarios de trabalho de uma agenda no dia da semana, vazio quando a agenda nao abre
+func horariosAgenda(agenda string, dia time.Weekday) []string {
+	expedientes.mu.RLock()
+	defer expedientes.mu.RUnlock()
+	j, ok := expedientes.agendas[agenda][dia]
+	if !ok {
+		return nil
+	}
+	return j.horarios()
+}
+
+// horarios em que as duas agendas trabalham no dia da semana
+func horariosTrabalhoDia(dia time.Weekday) []string {
+	proteger := make(map[string]bool)
+	for _, h := range horariosAgenda(agendaProteger, dia) {
+		proteger[h] = true
+	}
+	var horarios []string
+	for _, h := range horariosAgenda(agendaClientes, dia) {
+		if proteger[h] {
+			horarios = append(horarios, h)
+		}
+	}
+	return horarios
+}
+
+// criar a tabela de expediente se ja nao existe, cada linha é o expediente de uma agenda em um dia da semana
+func createExpedienteTable(ctx context.Context, db *sql.DB) error {
+	query := `CREATE TABLE IF NOT EXISTS expediente (
+    agenda VARCHAR(20) NOT NULL,
+    dia_semana SMALLINT NOT NULL CHECK (dia_semana BETWEEN 0 AND 6),
+    inicio CHAR(5) NOT NULL,
+    fim CHAR(5) NOT NULL,
+    duracao_minutos INT NOT NULL CHECK (duracao_minutos > 0),
+    pausas TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (agenda, dia_semana)
+);`
+	_, err := db.ExecContext(ctx, query)
+	return err
+}
+
+// le os modelos de expediente do banco, agendas sem linhas nao aparecem no resultado.
+// as pausas ficam no formato "12:00-13:00,15:00-15:15" e o dia da semana vai de 0 (domingo) a 6 (sabado)
+func fetchExpediente(ctx context.Context, db *sql.DB) (map[string]ModeloExpediente, error) {
+	rows, err := db.QueryContext(ctx, `SELECT agenda, dia_semana, inicio, fim, duracao_minutos, pausas FROM expediente`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	modelos := make(map[string]ModeloExpediente)
+	for rows.Next() {
+		var agenda, pausas string
+		var dia, duracao int
+		var j JornadaDia
+		if err := rows.Scan(&agenda, &dia, &j.Inicio, &j.Fim, &duracao, &pausas); err != nil {
+			return nil, err
+		}
+		j.Duracao = time.Duration(duracao) * time.Minute
+		for _, p := range strings.Split(pausas, ",") {
+			if strings.TrimSpace(p) == "" {
+				continue
+			}
+			inicio, fim, ok := strings.Cut(p, "-")
+			if !ok {
+				return nil, fmt.Errorf("pausa inválida %q na agenda %s, dia %d", p, agenda, dia)
+			}
+			j.Pausas = append(j.Pausas, Pausa{Inicio: strings.TrimSpace(inicio), Fim: strings.TrimSpace(fim)})
+		}
+		if modelos[agenda] == nil {
+			modelos[agenda] = make(ModeloExpediente)
+		}
+		modelos[agenda][nomeDia(time.Weekday(dia))] = j
+	}
+	return modelos, rows.Err()
+}
+
+// recarrega o expediente da configuração e, com a fonte postgres, do banco.
+// se o banco falhar o expediente anterior continua valendo, ou o da configuração na subida
+func atualizarExpediente(ctx context.Context, db *sql.DB) error {
+	modelos := make(map[string]ModeloExpediente, len(cfg.Expediente.Agendas))
+	for agenda, modelo := range cfg.Expediente.Agendas {
+		modelos[agenda] = modelo
+	}
+	if cfg.Expediente.Fonte != expedienteFontePostgres {
+		return aplicarExpediente(modelos)
+	}
+	doBanco, err := func() (map[string]ModeloExpediente, error) {
+		if err := createExpedienteTable(ctx, db); err != nil {
+			return nil, fmt.Errorf("erro ao criar tabela de expediente: %w", err)
+		}
+		doBanco, err := fetchExpediente(ctx, db)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao buscar expediente no banco: %w", err)
+		}
+		return doBanco, nil
+	}()
+	if err == nil {
+		// as agendas cadastradas no banco substituem as da configuração
+		comBanco := make(map[string]ModeloExpediente, len(modelos)+len(doBanco))
+		for agenda, modelo := range modelos {
+			comBanco[agenda] = modelo
+		}
+		for agenda, modelo := range doBanco {
+			comBanco[agenda] = modelo
+		}
+		if err = aplicarExpediente(comBanco); err == nil {
+			return nil
+		}
+		err = fmt.Errorf("expediente inválido no banco: %w", err)
+	}
+	expedientes.mu.RLock()
+	carregado := expedientes.agendas != nil
+	expedientes.mu.RUnlock()
+	if !carregado {
+		if errConfig := aplicarExpediente(modelos); errConfig != nil {
+			return errConfig
+		}
+	}
+	return err
+}
+
+// valida os modelos e troca o expediente em uso
+func aplicarExpediente(modelos map[string]ModeloExpediente) error {
+	agendas, err := montarExpediente(modelos)
+	if err != nil {
+		return err
+	}
+	expedientes.mu.Lock()
+	expedientes.agendas = agendas
+	expedientes.mu.Unlock()
+	log.Println("expediente carregado:", resumoExpediente(agendas))
+	return nil
+}
+
+// nome curto do dia da semana usado na configuração
+func nomeDia(dia time.Weekday) string {
+	for nome, d := range diasSemana {
+		if d == dia {
+			return nome
+		}
+	}
+	return strconv.Itoa(int(dia))
+}
+
+// descrição curta do expediente para o log, ex: clientes [seg 07:30-17:00/30m ...]
+func resumoExpediente(agendas map[string]map[time.Weekday]jornada) string {
+	var partes []string
+	for agenda, dias := range agendas {
+		var abertos []string
+		for dia := time.Sunday; dia <= time.Saturday; dia++ {
+			if j, ok := dias[dia]; ok {
+				abertos = append(abertos, fmt.Sprintf("%s %02d:%02d-%02d:%02d/%dm", nomeDia(dia), j.inicio/60, j.inicio%60, j.fim/60, j.fim%60, j.duracao))
+			}
+		}
+		partes = append(partes, agenda+" ["+strings.Join(abertos, " ")+"]")
+	}
+	sort.Strings(partes)
+	return strings.Join(partes, ", ")
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/transform"
+)
+
+// caminhos dos serviços do SOC a partir de soc.base_url
+const (
+	socCaminhoExportadados  = "/WebSoc/exportadados"
+	socCaminhoAgendamentoWs = "/WSoc/AgendamentoWs?wsdl"
+	socCaminhoFuncionarioWs = "/WSoc/FuncionarioModelo2Ws?wsdl"
+)
+
+// url completa de um serviço do SOC
+func socURL(caminho string) string {
+	return strings.TrimRight(cfg.SOC.BaseURL, "/") + caminho
+}
+
+// credenciais comuns a todos os exportadados
+type exportaDadosBase struct {
+	Empresa   string `json:"empresa"`
+	Codigo    string `json:"codigo"`
+	Chave     string `json:"chave"`
+	TipoSaida string `json:"tipoSaida"`
+}
+
+// parametros do exportadados de empresas
+type paramEmpresas struct {
+	exportaDadosBase
+	EmpresaFiltro   string `json:"empresafiltro"`
+	Subgrupo        string `json:"subgrupo"`
+	Socnet          string `json:"socnet"`
+	MostrarInativas string `json:"mostrarinativas"`
+}
+
+// parametros do exportadados de setores
+type paramSetores struct {
+	exportaDadosBase
+}
+
+// parametros do exportadados de hierarquia, a empresa é a consultada
+type paramHierarquia struct {
+	exportaDadosBase
+}
+
+// parametros do exportadados de funcionario por cpf
+type paramFuncionario struct {
+	exportaDadosBase
+	EmpresaTrabalho string `json:"empresaTrabalho"`
+	CPF             string `json:"cpf"`
+	ParametroData   string `json:"parametroData"`
+	DataInicio      string `json:"dataInicio"`
+	DataFim         string `json:"dataFim"`
+}
+
+// parametros do exportadados de agendamentos de uma agenda
+type paramAgendamentos struct {
+	exportaDadosBase
+	EmpresaTrabalho    string `json:"empresaTrabalho"`
+	DataInicio         string `json:"dataInicio"`
+	DataFim            string `json:"dataFim"`
+	CodigoAgenda       string `json:"codigoAgenda"`
+	StatusAgendaFiltro string `json:"statusAgendaFiltro"`
+}
+
+// monta as credenciais do exportadados para a empresa informada
+func newExportaDadosBase(empresa string, cred ExportaDadosCredencial) exportaDadosBase {
+	return exportaDadosBase{Empresa: empresa, Codigo: cred.Codigo, Chave: cred.Chave, TipoSaida: "json"}
+}
+
+// formata a data no padrão dd/mm/aaaa do SOC
+func socData(t time.Time) string {
+	return t.Format("02/01/2006")
+}
+
+// cliente do exportadados do SOC
+type exportaDadosClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+// cliente usado pelas consultas ao SOC, montado no main a partir da configuração
+var socExporta *exportaDadosClient
+
+// serializa os parametros em json e codifica na query da url
+func (c *exportaDadosClient) url(parametro any) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(parametro); err != nil {
+		return "", fmt.Errorf("erro ao serializar parametros do exportadados: %w", err)
+	}
+	js := strings.TrimSpace(buf.String())
+	return c.baseURL + "?" + url.Values{"parametro": {js}}.Encode(), nil
+}
+
+// executa o exportadados e devolve a resposta http
+func (c *exportaDadosClient) requisitar(ctx context.Context, nome string, parametro any, attrs ...attribute.KeyValue) (*http.Response, error) {
+	u, err := c.url(parametro)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := doSOC(nome, c.client, req, true, attrs...)
+	if err != nil {
+		// o *url.Error traz a url com a chave, repassa so a causa
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return nil, fmt.Errorf("exportadados %s: %w", nome, err)
+	}
+	return res, nil
+}
+
+// executa o exportadados e devolve o corpo da resposta sem conversão de charset
+func (c *exportaDadosClient) buscar(ctx context.Context, nome string, parametro any, attrs ...attribute.KeyValue) ([]byte, error) {
+	res, err := c.requisitar(ctx, nome, parametro, attrs...)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("exportadados %s: erro ao ler resposta: %w", nome, err)
+	}
+	if err := classificarRespostaSOC(nome, res.StatusCode, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// tamanho maximo lido de uma resposta de erro do SOC
+const limiteRespostaErro = 64 << 10
+
+// executa o exportadados e devolve o corpo como stream ja convertido para UTF-8,
+// so as respostas de erro (pequenas) sao lidas inteiras para classificação
+func (c *exportaDadosClient) abrir(ctx context.Context, nome string, parametro any, attrs ...attribute.KeyValue) (io.ReadCloser, error) {
+	res, err := c.requisitar(ctx, nome, parametro, attrs...)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReaderSize(res.Body, 4096)
+	if res.StatusCode < 400 && comecaComJSON(br) {
+		return struct {
+			io.Reader
+			io.Closer
+		}{leitorUTF8(br, res.Header.Get("Content-Type")), res.Body}, nil
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(br, limiteRespostaErro))
+	if err != nil {
+		return nil, fmt.Errorf("exportadados %s: erro ao ler resposta: %w", nome, err)
+	}
+	if err := classificarRespostaSOC(nome, res.StatusCode, body); err != nil {
+		return nil, err
+	}
+	return nil, &SOCError{Tipo: ErrSOCFalha, Upstream: nome, Detalhe: "resposta inesperada"}
+}
+
+// olha o primeiro caractere relevante do corpo sem consumir o stream
+func comecaComJSON(br *bufio.Reader) bool {
+	for i := 1; i <= br.Size(); i++ {
+		p, err := br.Peek(i)
+		if len(p) < i || err != nil {
+			return false
+		}
+		switch p[i-1] {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '[', '{':
+			return true
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// converte o stream para UTF-8: um charset diferente de utf-8 no header é respeitado,
+// senao os bytes que nao formam UTF-8 valido sao lidos como ISO-8859-1, o padrão do SOC
+func leitorUTF8(r io.Reader, contentType string) io.Reader {
+	if _, params, err := mime.ParseMediaType(contentType); err == nil && params["charset"] != "" && !strings.EqualFold(params["charset"], "utf-8") {
+		if conv, err := charset.NewReaderLabel(params["charset"], r); err == nil {
+			return conv
+		}
+	}
+	return transform.NewReader(r, utf8OuLatin1{})
+}
+
+// transformer que mantem as sequencias UTF-8 validas e converte os demais bytes de ISO-8859-1
+type utf8OuLatin1 struct{ transform.NopResetter }
+
+func (utf8OuLatin1) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		c := src[nSrc]
+		if c < utf8.RuneSelf {
+			if nDst >= len(dst) {
+				return nDst, nSrc, transform.ErrShortDst
+			}
+			dst[nDst] = c
+			nDst++
+			nSrc++
+			continue
+		}
+		r, size := utf8.DecodeRune(src[nSrc:])
+		if r == utf8.RuneError && size == 1 {
+			// sequencia cortada no fim do buffer, espera o resto
+			if !atEOF && !utf8.FullRune(src[nSrc:]) {
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+			r = rune(c)
+		}
+		if nDst+utf8.RuneLen(r) > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += utf8.EncodeRune(dst[nDst:], r)
+		nSrc += size
+	}
+	return nDst, nSrc, nil
+}
+
+// decodifica uma lista json item a item, guardando so os itens aceitos pelo filtro
+func decodificarLista[T any](r io.Reader, manter func(*T) bool) ([]T, error) {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '[' {
+		return nil, fmt.Errorf("esperava uma lista json, veio %v", tok)
+	}
+	var itens []T
+	for dec.More() {
+		var item T
+		if err := dec.Decode(&item); err != nil {
+			return nil, err
+		}
+		if manter == nil || manter(&item) {
+			itens = append(itens, item)
+		}
+	}
+	// fecha a lista
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return itens, nil
+}
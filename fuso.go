@@ -0,0 +1,57 @@
+package main
+
+import (
+	"log"
+	"time"
+	// base de fusos embutida no binario, a imagem do container nao tem /usr/share/zoneinfo
+	_ "time/tzdata"
+)
+
+// fuso das agendas, todas as datas e horarios de agendamento sao de Sao Paulo
+var fusoSaoPaulo = func() *time.Location {
+	loc, err := time.LoadLocation("America/Sao_Paulo")
+	if err != nil {
+		log.Fatalf("Erro ao carregar o fuso America/Sao_Paulo: %v", err)
+	}
+	return loc
+}()
+
+// hora atual em Sao Paulo
+func agoraSaoPaulo() time.Time {
+	return time.Now().In(fusoSaoPaulo)
+}
+
+// converte dd/mm/aaaa para a meia-noite do dia em Sao Paulo
+func parseDia(data string) (time.Time, error) {
+	return time.ParseInLocation("02/01/2006", data, fusoSaoPaulo)
+}
+
+// meia-noite em Sao Paulo do dia em que t cai
+func inicioDoDia(t time.Time) time.Time {
+	ano, mes, dia := t.In(fusoSaoPaulo).Date()
+	return time.Date(ano, mes, dia, 0, 0, 0, 0, fusoSaoPaulo)
+}
+
+// o dia é anterior ao dia de agora em Sao Paulo
+func diaPassado(dia, agora time.Time) bool {
+	return inicioDoDia(dia).Before(inicioDoDia(agora))
+}
+
+// inicio do horario "HH:MM" no dia, em Sao Paulo
+func horarioDoDia(dia time.Time, hhmm string) (time.Time, error) {
+	h, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return time.Time{}, err
+	}
+	ano, mes, d := dia.In(fusoSaoPaulo).Date()
+	return time.Date(ano, mes, d, h.Hour(), h.Minute(), 0, 0, fusoSaoPaulo), nil
+}
+
+// o horario do dia ja começou, horario inválido conta como passado para nao ser oferecido
+func horarioPassado(dia time.Time, hhmm string, agora time.Time) bool {
+	inicio, err := horarioDoDia(dia, hhmm)
+	if err != nil {
+		return true
+	}
+	return !inicio.After(agora)
+}
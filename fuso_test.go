@@ -0,0 +1,143 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// horario fixo em Sao Paulo usado como agora nos testes
+func agoraSP(t *testing.T, valor string) time.Time {
+	t.Helper()
+	agora, err := time.ParseInLocation("02/01/2006 15:04", valor, fusoSaoPaulo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return agora
+}
+
+func diaSP(t *testing.T, data string) time.Time {
+	t.Helper()
+	dia, err := parseDia(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dia
+}
+
+func TestParseDia(t *testing.T) {
+	casos := []struct {
+		data     string
+		esperado time.Time
+		erro     bool
+	}{
+		{"19/10/2026", time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC), false},
+		{"01/01/2027", time.Date(2027, 1, 1, 3, 0, 0, 0, time.UTC), false},
+		{"2026-10-19", time.Time{}, true},
+		{"32/10/2026", time.Time{}, true},
+	}
+	for _, c := range casos {
+		dia, err := parseDia(c.data)
+		if (err != nil) != c.erro {
+			t.Fatalf("parseDia(%q) erro = %v, esperava erro %v", c.data, err, c.erro)
+		}
+		if c.erro {
+			continue
+		}
+		if !dia.Equal(c.esperado) || dia.Location() != fusoSaoPaulo {
+			t.Errorf("parseDia(%q) = %v, esperava %v em Sao Paulo", c.data, dia, c.esperado)
+		}
+	}
+}
+
+func TestDiaPassado(t *testing.T) {
+	casos := []struct {
+		nome     string
+		dia      string
+		agora    time.Time
+		esperado bool
+	}{
+		{"hoje as 23:30 BRT", "19/10/2026", agoraSP(t, "19/10/2026 23:30"), false},
+		{"ontem as 23:30 BRT", "18/10/2026", agoraSP(t, "19/10/2026 23:30"), true},
+		{"amanha as 23:30 BRT", "20/10/2026", agoraSP(t, "19/10/2026 23:30"), false},
+		{"hoje as 00:10 BRT", "19/10/2026", agoraSP(t, "19/10/2026 00:10"), false},
+		{"ontem as 00:10 BRT", "18/10/2026", agoraSP(t, "19/10/2026 00:10"), true},
+		// 02:30Z do dia 20 ainda é dia 19 em Sao Paulo
+		{"02:30Z ainda é hoje em SP", "19/10/2026", time.Date(2026, 10, 20, 2, 30, 0, 0, time.UTC), false},
+		{"02:30Z o dia UTC ainda nao chegou em SP", "20/10/2026", time.Date(2026, 10, 20, 2, 30, 0, 0, time.UTC), false},
+		{"02:30Z ontem em SP", "18/10/2026", time.Date(2026, 10, 20, 2, 30, 0, 0, time.UTC), true},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			if got := diaPassado(diaSP(t, c.dia), c.agora); got != c.esperado {
+				t.Errorf("diaPassado(%s, %v) = %v, esperava %v", c.dia, c.agora, got, c.esperado)
+			}
+		})
+	}
+}
+
+func TestHorarioPassado(t *testing.T) {
+	casos := []struct {
+		nome     string
+		dia      string
+		horario  string
+		agora    time.Time
+		esperado bool
+	}{
+		{"horario exatamente agora", "19/10/2026", "08:00", agoraSP(t, "19/10/2026 08:00"), true},
+		{"horario um minuto depois", "19/10/2026", "08:01", agoraSP(t, "19/10/2026 08:00"), false},
+		{"ultimo horario as 23:30 BRT", "19/10/2026", "23:30", agoraSP(t, "19/10/2026 23:30"), true},
+		{"amanha cedo as 23:30 BRT", "20/10/2026", "07:30", agoraSP(t, "19/10/2026 23:30"), false},
+		{"madrugada as 00:10 BRT", "19/10/2026", "00:00", agoraSP(t, "19/10/2026 00:10"), true},
+		{"manha as 00:10 BRT", "19/10/2026", "07:30", agoraSP(t, "19/10/2026 00:10"), false},
+		// 02:30Z do dia 20 sao 23:30 do dia 19 em SP, a madrugada do dia 20 ainda nao chegou
+		{"02:30Z madrugada de amanha em SP", "20/10/2026", "01:00", time.Date(2026, 10, 20, 2, 30, 0, 0, time.UTC), false},
+		{"02:30Z noite de hoje em SP", "19/10/2026", "23:00", time.Date(2026, 10, 20, 2, 30, 0, 0, time.UTC), true},
+		{"02:00Z horario exatamente agora em SP", "19/10/2026", "23:00", time.Date(2026, 10, 20, 2, 0, 0, 0, time.UTC), true},
+		{"horario inválido", "19/10/2026", "8h", agoraSP(t, "19/10/2026 00:10"), true},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			if got := horarioPassado(diaSP(t, c.dia), c.horario, c.agora); got != c.esperado {
+				t.Errorf("horarioPassado(%s, %s, %v) = %v, esperava %v", c.dia, c.horario, c.agora, got, c.esperado)
+			}
+		})
+	}
+}
+
+func TestHorariosLivresDia(t *testing.T) {
+	grade := []string{"07:30", "08:00", "08:30", "23:00", "23:30"}
+	// todos os horarios com vaga nas duas agendas pelas regras padrao
+	clientes := map[string]ocupacao{}
+	proteger := map[string]ocupacao{}
+	for _, h := range grade {
+		clientes[h] = ocupacao{livres: 1}
+		proteger[h] = ocupacao{livres: 2}
+	}
+	casos := []struct {
+		nome     string
+		dia      string
+		agora    time.Time
+		esperado []string
+	}{
+		{"23:30 BRT", "19/10/2026", agoraSP(t, "19/10/2026 23:30"), []string{}},
+		{"23:30 BRT dia seguinte", "20/10/2026", agoraSP(t, "19/10/2026 23:30"), grade},
+		{"00:10 BRT", "19/10/2026", agoraSP(t, "19/10/2026 00:10"), grade},
+		{"02:30Z ainda dia anterior em SP", "19/10/2026", time.Date(2026, 10, 20, 2, 30, 0, 0, time.UTC), []string{}},
+		{"02:00Z so o ultimo horario", "19/10/2026", time.Date(2026, 10, 20, 2, 0, 0, 0, time.UTC), []string{"23:30"}},
+		{"horario exatamente agora fica de fora", "19/10/2026", agoraSP(t, "19/10/2026 08:00"), []string{"08:30", "23:00", "23:30"}},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			got := horariosLivresDia(diaSP(t, c.dia), grade, clientes, proteger, c.agora)
+			if !slices.Equal(got, c.esperado) {
+				t.Errorf("horariosLivresDia = %v, esperava %v", got, c.esperado)
+			}
+		})
+	}
+	// sem vaga na Proteger o horario nao é oferecido
+	semProteger := map[string]ocupacao{"08:30": {livres: 1}}
+	if got := horariosLivresDia(diaSP(t, "20/10/2026"), []string{"08:30"}, clientes, semProteger, agoraSP(t, "19/10/2026 23:30")); len(got) != 0 {
+		t.Errorf("horariosLivresDia com uma vaga na Proteger = %v, esperava vazio", got)
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// modos de gravação das chamadas externas
+const (
+	gravacaoGravar     = "gravar"
+	gravacaoReproduzir = "reproduzir"
+)
+
+// nenhuma gravação corresponde a requisição no modo reproduzir
+var ErrGravacaoAusente = errors.New("nenhuma gravação para a requisição")
+
+// chamada gravada, o corpo da resposta fica em um arquivo .corpo ao lado
+// com os bytes originais do SOC (charset incluso)
+type interacaoGravada struct {
+	Chave       string `json:"chave"`
+	Metodo      string `json:"metodo"`
+	URL         string `json:"url"`
+	Corpo       string `json:"corpo,omitempty"`
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type,omitempty"`
+	arquivo     string
+}
+
+// transport que grava as chamadas em disco ou responde com as gravações,
+// dados pessoais e credenciais sao removidos antes de gravar
+type gravacaoTransport struct {
+	modo      string
+	diretorio string
+	proximo   http.RoundTripper
+
+	mu sync.Mutex
+	// quantidade de chamadas gravadas ou reproduzidas por chave
+	contagem map[string]int
+	// gravações carregadas no modo reproduzir, na ordem em que foram feitas
+	gravacoes map[string][]interacaoGravada
+}
+
+// envolve o transport do cliente no modo configurado
+func newGravacaoTransport(c GravacaoConfig, proximo http.RoundTripper) (*gravacaoTransport, error) {
+	t := &gravacaoTransport{
+		modo:      c.Modo,
+		diretorio: c.Diretorio,
+		proximo:   proximo,
+		contagem:  make(map[string]int),
+		gravacoes: make(map[string][]interacaoGravada),
+	}
+	switch c.Modo {
+	case gravacaoGravar:
+		if err := os.MkdirAll(c.Diretorio, 0o755); err != nil {
+			return nil, fmt.Errorf("erro ao criar diretorio de gravação %s: %w", c.Diretorio, err)
+		}
+	case gravacaoReproduzir:
+		if err := t.carregar(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("modo de gravação desconhecido %q", c.Modo)
+	}
+	return t, nil
+}
+
+// le as gravações do diretorio agrupadas pela chave da requisição
+func (t *gravacaoTransport) carregar() error {
+	arquivos, err := filepath.Glob(filepath.Join(t.diretorio, "*.json"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(arquivos)
+	for _, arquivo := range arquivos {
+		data, err := os.ReadFile(arquivo)
+		if err != nil {
+			return fmt.Errorf("erro ao ler gravação %s: %w", arquivo, err)
+		}
+		var g interacaoGravada
+		if err := json.Unmarshal(data, &g); err != nil {
+			return fmt.Errorf("erro ao interpretar gravação %s: %w", arquivo, err)
+		}
+		g.arquivo = strings.TrimSuffix(arquivo, ".json") + ".corpo"
+		t.gravacoes[g.Chave] = append(t.gravacoes[g.Chave], g)
+	}
+	if len(t.gravacoes) == 0 {
+		return fmt.Errorf("nenhuma gravação encontrada em %s", t.diretorio)
+	}
+	return nil
+}
+
+func (t *gravacaoTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var corpo []byte
+	if req.Body != nil {
+		var err error
+		corpo, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(corpo))
+	}
+	urlLimpa := limparURL(req.URL)
+	corpoLimpo := string(limparCorpo(corpo))
+	soma := sha256.Sum256([]byte(req.Method + "\n" + urlLimpa + "\n" + corpoLimpo))
+	chave := hex.EncodeToString(soma[:8])
+
+	if t.modo == gravacaoReproduzir {
+		return t.reproduzir(req, chave)
+	}
+	res, err := t.proximo.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	g := interacaoGravada{
+		Chave:       chave,
+		Metodo:      req.Method,
+		URL:         urlLimpa,
+		Corpo:       corpoLimpo,
+		Status:      res.StatusCode,
+		ContentType: res.Header.Get("Content-Type"),
+	}
+	if err := t.gravar(req.URL, g, limparCorpo(body)); err != nil {
+		// a chamada real ja foi feita, a falha na gravação nao derruba a requisição
+		requestLogger(req.Context()).Println("erro ao gravar chamada externa:", err)
+	}
+	return res, nil
+}
+
+// grava a chamada e o corpo da resposta ja sem dados pessoais
+func (t *gravacaoTransport) gravar(u *url.URL, g interacaoGravada, corpo []byte) error {
+	t.mu.Lock()
+	t.contagem[g.Chave]++
+	n := t.contagem[g.Chave]
+	t.mu.Unlock()
+	base := filepath.Join(t.diretorio, fmt.Sprintf("%s-%s-%03d", path.Base(u.Path), g.Chave, n))
+	var data bytes.Buffer
+	enc := json.NewEncoder(&data)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(g); err != nil {
+		return err
+	}
+	if err := os.WriteFile(base+".corpo", corpo, 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(base+".json", data.Bytes(), 0o644)
+}
+
+// responde com a proxima gravação da chave, a ultima é repetida quando acabam
+func (t *gravacaoTransport) reproduzir(req *http.Request, chave string) (*http.Response, error) {
+	t.mu.Lock()
+	lista := t.gravacoes[chave]
+	n := t.contagem[chave]
+	t.contagem[chave]++
+	t.mu.Unlock()
+	if len(lista) == 0 {
+		return nil, fmt.Errorf("%w: %s %s", ErrGravacaoAusente, req.Method, limparURL(req.URL))
+	}
+	g := lista[min(n, len(lista)-1)]
+	corpo, err := os.ReadFile(g.arquivo)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler corpo gravado %s: %w", g.arquivo, err)
+	}
+	header := make(http.Header)
+	if g.ContentType != "" {
+		header.Set("Content-Type", g.ContentType)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", g.Status, http.StatusText(g.Status)),
+		StatusCode:    g.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(corpo)),
+		ContentLength: int64(len(corpo)),
+		Request:       req,
+	}, nil
+}
+
+// campos json e elementos xml com dados pessoais ou credenciais, comparados em minusculas.
+// credenciais e valores gerados a cada chamada viram *** para a chave da gravação ficar estavel
+var (
+	camposCredenciais = regexp.MustCompile(`^(chave|senha|password|username|usuario|nonce|created|expires|token|authorization|matricula|data_?admissao)$`)
+	camposPessoais    = regexp.MustCompile(`^(cpf\w*|rg\w*|pis\w*|nis|ctps\w*|nome|nome_?funcionario|nome_?mae|nome_?pai|nome_?social|data_?nascimento|email\w*|\w*telefone\w*|\w*celular\w*|\w*fone)$`)
+
+	reCampoJSON = regexp.MustCompile(`"([A-Za-z_]+)"(\s*:\s*)"((?:[^"\\]|\\.)*)"`)
+	// o exportadados manda alguns codigos e documentos como numero, sem aspas
+	reNumeroJSON = regexp.MustCompile(`"([A-Za-z_]+)"(\s*:\s*)(-?\d+(?:\.\d+)?)\b`)
+	reCampoXML   = regexp.MustCompile(`<((?:[\w-]+:)?([A-Za-z_]+))(\s[^>]*)?>([^<]*)</`)
+	reCPF        = regexp.MustCompile(`\b\d{3}\.\d{3}\.\d{3}-\d{2}\b`)
+	// o WS-Security repete o horario da chamada no atributo wsu:Id
+	reIDXML = regexp.MustCompile(`(\w+:Id=")[^"]*(")`)
+)
+
+// mascara de um campo pelo nome, vazio quando o campo pode ser gravado
+func mascaraCampo(nome string) func([]byte) []byte {
+	nome = strings.ToLower(nome)
+	switch {
+	case camposCredenciais.MatchString(nome):
+		return func([]byte) []byte { return []byte("***") }
+	case camposPessoais.MatchString(nome):
+		return mascararValor
+	}
+	return nil
+}
+
+// troca digitos por 0 e letras por X mantendo o tamanho e a pontuação,
+// bytes fora do ascii (acentos em ISO-8859-1 ou utf8) tambem viram X
+func mascararValor(v []byte) []byte {
+	out := make([]byte, 0, len(v))
+	for _, b := range v {
+		switch {
+		case b >= '0' && b <= '9':
+			out = append(out, '0')
+		case b >= 0x80 || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z'):
+			out = append(out, 'X')
+		default:
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// mascara de um numero json, continua sendo um numero valido para a reprodução:
+// credenciais viram 0 e os outros digitos viram 0 menos o primeiro, que vira 1
+// quando o numero tem mais de um digito antes do ponto
+func mascararNumero(nome string, v []byte) []byte {
+	if camposCredenciais.MatchString(strings.ToLower(nome)) {
+		return []byte("0")
+	}
+	out := mascararValor(v)
+	inicio := 0
+	if out[0] == '-' {
+		inicio = 1
+	}
+	if len(out) > inicio+1 && out[inicio+1] >= '0' && out[inicio+1] <= '9' {
+		out[inicio] = '1'
+	}
+	return out
+}
+
+// remove dados pessoais e credenciais de um corpo json ou xml sem mudar o charset
+func limparCorpo(corpo []byte) []byte {
+	corpo = reCampoJSON.ReplaceAllFunc(corpo, func(m []byte) []byte {
+		sub := reCampoJSON.FindSubmatch(m)
+		mascara := mascaraCampo(string(sub[1]))
+		if mascara == nil {
+			return m
+		}
+		return bytes.Join([][]byte{[]byte(`"`), sub[1], []byte(`"`), sub[2], []byte(`"`), mascara(sub[3]), []byte(`"`)}, nil)
+	})
+	corpo = reNumeroJSON.ReplaceAllFunc(corpo, func(m []byte) []byte {
+		sub := reNumeroJSON.FindSubmatch(m)
+		if mascaraCampo(string(sub[1])) == nil {
+			return m
+		}
+		return bytes.Join([][]byte{[]byte(`"`), sub[1], []byte(`"`), sub[2], mascararNumero(string(sub[1]), sub[3])}, nil)
+	})
+	corpo = reCampoXML.ReplaceAllFunc(corpo, func(m []byte) []byte {
+		sub := reCampoXML.FindSubmatch(m)
+		mascara := mascaraCampo(string(sub[2]))
+		if mascara == nil || len(bytes.TrimSpace(sub[4])) == 0 {
+			return m
+		}
+		return bytes.Join([][]byte{[]byte("<"), sub[1], sub[3], []byte(">"), mascara(sub[4]), []byte("</")}, nil)
+	})
+	corpo = reIDXML.ReplaceAll(corpo, []byte("${1}***${2}"))
+	return reCPF.ReplaceAllFunc(corpo, mascararValor)
+}
+
+// caminho e query sem credenciais e dados pessoais, o parametro do exportadados é limpo como json.
+// o host fica de fora para as gravações valerem em qualquer ambiente
+func limparURL(u *url.URL) string {
+	if !strings.Contains(u.RawQuery, "=") {
+		return u.RequestURI()
+	}
+	q := u.Query()
+	for nome, valores := range q {
+		for i, v := range valores {
+			if mascara := mascaraCampo(nome); mascara != nil {
+				valores[i] = string(mascara([]byte(v)))
+				continue
+			}
+			valores[i] = string(limparCorpo([]byte(v)))
+		}
+	}
+	return u.EscapedPath() + "?" + q.Encode()
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLimparCorpoNumeros(t *testing.T) {
+	casos := []struct {
+		nome, corpo, esperado string
+	}{
+		{"cpf numerico", `{"CPFFUNCIONARIO": 12345678900}`, `{"CPFFUNCIONARIO": 10000000000}`},
+		{"pis numerico", `{"PIS":12045678901,"SETOR":10}`, `{"PIS":10000000000,"SETOR":10}`},
+		{"um digito", `{"RG":7}`, `{"RG":0}`},
+		{"credencial numerica", `{"matricula": 98765}`, `{"matricula": 0}`},
+		{"campo livre", `{"CODIGO": 1005, "VAGAS": 2.5}`, `{"CODIGO": 1005, "VAGAS": 2.5}`},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			got := limparCorpo([]byte(c.corpo))
+			if string(got) != c.esperado {
+				t.Errorf("limparCorpo = %s, esperava %s", got, c.esperado)
+			}
+			if !json.Valid(got) {
+				t.Errorf("corpo limpo deixou de ser json: %s", got)
+			}
+		})
+	}
+}
+
+func TestGravacaoLimpaEReproduzLatin1(t *testing.T) {
+	// resposta do exportadados em ISO-8859-1: "José da Conceição" e setor "Administração"
+	original := []byte("[{\"NOME\":\"Jos\xe9 da Concei\xe7\xe3o\",\"CPFFUNCIONARIO\": 12345678900,\"PIS\":\"120.45678.90-1\",\"SETOR\":\"Administra\xe7\xe3o\"}]")
+	const contentType = "application/json; charset=ISO-8859-1"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Write(original)
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	chamar := func(transport http.RoundTripper) ([]byte, string) {
+		t.Helper()
+		req, err := http.NewRequest("GET", srv.URL+`/WebSoc/exportadados?parametro={"empresa":"100","chave":"segredo"}`, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return body, res.Header.Get("Content-Type")
+	}
+
+	gravacao, err := newGravacaoTransport(GravacaoConfig{Modo: gravacaoGravar, Diretorio: dir}, http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// quem chamou recebe a resposta original
+	if body, _ := chamar(gravacao); !bytes.Equal(body, original) {
+		t.Fatalf("resposta gravada alterada: %q", body)
+	}
+
+	arquivos, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(arquivos) != 2 {
+		t.Fatalf("esperava .json e .corpo, veio %v", arquivos)
+	}
+	for _, arquivo := range arquivos {
+		data, err := os.ReadFile(arquivo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, dado := range []string{"12345678900", "120.45678.90-1", "Jos\xe9", "Concei", "segredo"} {
+			if bytes.Contains(data, []byte(dado)) {
+				t.Errorf("%s gravado com %q: %s", filepath.Base(arquivo), dado, data)
+			}
+		}
+	}
+
+	reproducao, err := newGravacaoTransport(GravacaoConfig{Modo: gravacaoReproduzir, Diretorio: dir}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, ct := chamar(reproducao)
+	if ct != contentType {
+		t.Errorf("content type reproduzido = %q", ct)
+	}
+	// campos sem dado pessoal continuam com os bytes ISO-8859-1 do SOC
+	if !bytes.Contains(body, []byte("\"SETOR\":\"Administra\xe7\xe3o\"")) {
+		t.Errorf("setor em ISO-8859-1 perdido na reprodução: %q", body)
+	}
+	var registros []map[string]any
+	if err := json.Unmarshal(body, &registros); err != nil {
+		t.Fatalf("corpo reproduzido invalido %q: %v", body, err)
+	}
+	if cpf, ok := registros[0]["CPFFUNCIONARIO"].(float64); !ok || cpf != 10000000000 {
+		t.Errorf("CPFFUNCIONARIO reproduzido = %v", registros[0]["CPFFUNCIONARIO"])
+	}
+	if nome := registros[0]["NOME"]; nome != "XXXX XX XXXXXXXXX" {
+		t.Errorf("NOME reproduzido = %v", nome)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// momento em que a aplicação subiu
+var inicioProcesso = time.Now()
+
+// estado da ultima sincronização de empresas
+var syncState struct {
+	mu            sync.Mutex
+	ultimoSucesso time.Time
+	ultimoErro    string
+}
+
+// registra o resultado de uma execução do syncDataWithAPI
+func registrarSincronizacao(err error) {
+	syncState.mu.Lock()
+	defer syncState.mu.Unlock()
+	if err != nil {
+		syncState.ultimoErro = err.Error()
+		return
+	}
+	syncState.ultimoSucesso = time.Now()
+	syncState.ultimoErro = ""
+	syncLastSuccess.Set(float64(syncState.ultimoSucesso.Unix()))
+}
+
+// resultado de uma verificação de dependencia
+type checkResult struct {
+	Status  string `json:"status"`
+	Detalhe string `json:"detalhe,omitempty"`
+	Duracao string `json:"duracao"`
+}
+
+// resposta dos endpoints de saude
+type healthResponse struct {
+	Status       string                 `json:"status"`
+	AmbienteSOC  string                 `json:"ambiente_soc"`
+	Verificacoes map[string]checkResult `json:"verificacoes"`
+}
+
+// verificação de uma dependencia, retorna erro quando ela nao esta pronta
+type healthCheck func(ctx context.Context) (string, error)
+
+// liveness: o processo esta de pé e respondendo
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, healthResponse{
+		Status: "ok",
+		Verificacoes: map[string]checkResult{
+			"processo": {
+				Status:  "ok",
+				Detalhe: "no ar ha " + time.Since(inicioProcesso).Round(time.Second).String() + ", goroutines " + strconv.Itoa(runtime.NumGoroutine()),
+				Duracao: "0s",
+			},
+		},
+	})
+}
+
+// readiness: banco, sincronização e opcionalmente o SOC
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]healthCheck{
+		"postgres":      checkPostgres,
+		"sincronizacao": checkSincronizacao,
+	}
+	if cfg.Health.SOCProbe {
+		checks["soc"] = checkSOC
+	}
+	writeHealth(w, runChecks(r.Context(), checks))
+}
+
+// executa as verificações em paralelo, cada uma com o tempo limite configurado
+func runChecks(ctx context.Context, checks map[string]healthCheck) healthResponse {
+	resp := healthResponse{Status: "ok", Verificacoes: make(map[string]checkResult, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for nome, check := range checks {
+		wg.Add(1)
+		go func(nome string, check healthCheck) {
+			defer wg.Done()
+			cctx, cancel := context.WithTimeout(ctx, cfg.Health.Timeout)
+			defer cancel()
+			inicio := time.Now()
+			detalhe, err := check(cctx)
+			res := checkResult{Status: "ok", Detalhe: detalhe, Duracao: time.Since(inicio).Round(time.Millisecond).String()}
+			if err != nil {
+				res.Status = "falha"
+				res.Detalhe = err.Error()
+			}
+			mu.Lock()
+			resp.Verificacoes[nome] = res
+			if err != nil {
+				resp.Status = "indisponivel"
+			}
+			mu.Unlock()
+		}(nome, check)
+	}
+	wg.Wait()
+	return resp
+}
+
+// responde 200 quando tudo esta ok e 503 caso contrario, sempre com o ambiente do SOC em uso
+func writeHealth(w http.ResponseWriter, resp healthResponse) {
+	resp.AmbienteSOC = cfg.SOC.Ambiente
+	status := http.StatusOK
+	if resp.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// verifica o pool do postgres
+func checkPostgres(ctx context.Context) (string, error) {
+	if err := db.PingContext(ctx); err != nil {
+		return "", err
+	}
+	stats := db.Stats()
+	return "conexoes abertas " + strconv.Itoa(stats.OpenConnections) + ", em uso " + strconv.Itoa(stats.InUse), nil
+}
+
+// verifica se a ultima sincronização de empresas nao esta velha demais
+func checkSincronizacao(ctx context.Context) (string, error) {
+	syncState.mu.Lock()
+	ultimo, ultimoErro := syncState.ultimoSucesso, syncState.ultimoErro
+	syncState.mu.Unlock()
+	if ultimo.IsZero() {
+		// antes da primeira sincronização damos o mesmo prazo desde a subida
+		if time.Since(inicioProcesso) > cfg.Health.MaxSyncAge {
+			return "", fmt.Errorf("nenhuma sincronização concluida desde a subida (%s)", ultimoErro)
+		}
+		return "aguardando a primeira sincronização", nil
+	}
+	idade := time.Since(ultimo)
+	if idade > cfg.Health.MaxSyncAge {
+		return "", fmt.Errorf("ultima sincronização ha %s, limite %s (%s)", idade.Round(time.Second), cfg.Health.MaxSyncAge, ultimoErro)
+	}
+	return "ultima sincronização ha " + idade.Round(time.Second).String(), nil
+}
+
+// requisição leve ao SOC so para saber se ele responde
+func checkSOC(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", socURL(socCaminhoAgendamentoWs), nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := doUpstream(upstreamSOCProbe, upstreamClient, req)
+	if err != nil {
+		return "", err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 500 {
+		return "", fmt.Errorf("SOC respondeu %d", res.StatusCode)
+	}
+	return "SOC " + cfg.SOC.Ambiente + " respondeu " + strconv.Itoa(res.StatusCode), nil
+}
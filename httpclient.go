@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// cliente http compartilhado por todas as chamadas ao SOC e ao Blip,
+// montado no main a partir da configuração
+var upstreamClient = newUpstreamClient(defaultConfig().Upstream)
+
+// cria o cliente com um unico transport, timeouts de conexão e resposta e pool de conexões
+func newUpstreamClient(c UpstreamConfig) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   c.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   c.ConnectTimeout,
+		ResponseHeaderTimeout: c.ResponseTimeout,
+		ExpectContinueTimeout: time.Second,
+		MaxIdleConns:          c.MaxIdleConnsPerHost * 4,
+		MaxIdleConnsPerHost:   c.MaxIdleConnsPerHost,
+		IdleConnTimeout:       c.IdleConnTimeout,
+		ForceAttemptHTTP2:     true,
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   c.Timeout,
+	}
+}
@@ -0,0 +1,535 @@
+// Package fakesoc implementa um SOC falso em memoria para rodar a api e os
+// testes de integração sem chamar o ws1.soc.com.br: o exportadados com os
+// exports usados pela api e os serviços SOAP AgendamentoWs e
+// FuncionarioModelo2Ws, com dados vindos de fixtures e injeção de falhas.
+package fakesoc
+
+import (
+	"crypto/sha1"
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beevik/etree"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// fixtures padrão, usadas quando nenhum arquivo é informado
+//
+//go:embed fixtures/soc.json
+var fixturesPadrao []byte
+
+// alvos de injeção de falha
+const (
+	AlvoEmpresas              = "empresas"
+	AlvoSetores               = "setores"
+	AlvoHierarquia            = "hierarquia"
+	AlvoFuncionarios          = "funcionarios"
+	AlvoAgendamentos          = "agendamentos"
+	AlvoIncluirAgendamento    = "incluirAgendamento"
+	AlvoImportacaoFuncionario = "importacaoFuncionario"
+	AlvoTodos                 = "*"
+)
+
+// registro de um export, os campos sao repassados como estao no json
+type Registro map[string]any
+
+// codigo e chave de um export
+type Export struct {
+	Codigo string `json:"codigo"`
+	Chave  string `json:"chave"`
+}
+
+// dados iniciais do SOC falso
+type Fixtures struct {
+	EmpresaPrincipal string                `json:"empresaPrincipal"`
+	Usuario          string                `json:"usuario"`
+	Senha            string                `json:"senha"`
+	Exports          map[string]Export     `json:"exports"`
+	Empresas         []Registro            `json:"empresas"`
+	Setores          []Registro            `json:"setores"`
+	Hierarquia       map[string][]Registro `json:"hierarquia"`   // por empresa
+	Funcionarios     map[string][]Registro `json:"funcionarios"` // por empresa
+	// por codigo de agenda, datas "+N" sao relativas ao dia em que as fixtures sao carregadas
+	Agendas                  map[string][]Registro `json:"agendas"`
+	ProximoCodigoFuncionario int                   `json:"proximoCodigoFuncionario"`
+}
+
+// falha injetada em um alvo
+type Falha struct {
+	Status   int    `json:"status,omitempty"`   // status http da resposta
+	AtrasoMs int    `json:"atrasoMs,omitempty"` // espera antes de responder
+	Corpo    string `json:"corpo,omitempty"`    // corpo no lugar da resposta normal, ex: "Chave inválida" ou uma pagina html
+	Fault    string `json:"fault,omitempty"`    // SOAP Fault com esta mensagem
+	Derrubar bool   `json:"derrubar,omitempty"` // fecha a conexão sem responder
+	Vezes    int    `json:"vezes,omitempty"`    // quantas requisições falham, zero para sempre
+}
+
+// SOC falso, seguro para uso concorrente
+type Server struct {
+	mu       sync.Mutex
+	inicial  Fixtures
+	dados    Fixtures
+	falhas   map[string]*Falha
+	chamadas map[string]int
+	// agendamentos incluidos desde o reset, usado no codigo devolvido
+	ocupados int
+	mux      *http.ServeMux
+}
+
+// carrega as fixtures do arquivo, ou as padrão quando o caminho é vazio
+func LoadFixtures(path string) (Fixtures, error) {
+	data := fixturesPadrao
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return Fixtures{}, err
+		}
+	}
+	var f Fixtures
+	if err := json.Unmarshal(data, &f); err != nil {
+		return Fixtures{}, fmt.Errorf("fixtures invalidas: %w", err)
+	}
+	return f, nil
+}
+
+// cria o servidor com as fixtures informadas
+func New(f Fixtures) *Server {
+	s := &Server{inicial: f, mux: http.NewServeMux()}
+	s.Reset()
+	s.mux.HandleFunc("/WebSoc/exportadados", s.handleExportadados)
+	s.mux.HandleFunc("/WSoc/AgendamentoWs", s.handleAgendamentoWs)
+	s.mux.HandleFunc("/WSoc/FuncionarioModelo2Ws", s.handleFuncionarioWs)
+	s.mux.HandleFunc("/_fake/falhas", s.handleFalhas)
+	s.mux.HandleFunc("/_fake/reset", s.handleReset)
+	s.mux.HandleFunc("/_fake/chamadas", s.handleChamadas)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// volta aos dados das fixtures e remove as falhas
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dados = copiarFixtures(s.inicial, time.Now())
+	s.falhas = make(map[string]*Falha)
+	s.chamadas = make(map[string]int)
+	s.ocupados = 0
+}
+
+// injeta uma falha no alvo, AlvoTodos vale para todos os alvos sem falha propria
+func (s *Server) SetFalha(alvo string, f Falha) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.falhas[alvo] = &f
+}
+
+// remove todas as falhas injetadas
+func (s *Server) LimparFalhas() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.falhas = make(map[string]*Falha)
+}
+
+// quantidade de requisições recebidas por alvo
+func (s *Server) Chamadas(alvo string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.chamadas[alvo]
+}
+
+// registra a chamada e devolve a falha a aplicar, se houver
+func (s *Server) registrar(alvo string) *Falha {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chamadas[alvo]++
+	f, ok := s.falhas[alvo]
+	if !ok {
+		f, ok = s.falhas[AlvoTodos]
+	}
+	if !ok {
+		return nil
+	}
+	copia := *f
+	if f.Vezes > 0 {
+		f.Vezes--
+		if f.Vezes == 0 {
+			for k, v := range s.falhas {
+				if v == f {
+					delete(s.falhas, k)
+				}
+			}
+		}
+	}
+	return &copia
+}
+
+// aplica a falha, retorna true quando a resposta ja foi tratada
+func aplicarFalha(w http.ResponseWriter, f *Falha, soap bool) bool {
+	if f == nil {
+		return false
+	}
+	if f.AtrasoMs > 0 {
+		time.Sleep(time.Duration(f.AtrasoMs) * time.Millisecond)
+	}
+	if f.Derrubar {
+		if hj, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hj.Hijack(); err == nil {
+				conn.Close()
+				return true
+			}
+		}
+		panic(http.ErrAbortHandler)
+	}
+	switch {
+	case soap && f.Fault != "":
+		escreverFault(w, f.Fault)
+	case f.Corpo != "" || f.Status != 0:
+		status := f.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		w.Header().Set("Content-Type", "text/html;charset=ISO-8859-1")
+		w.WriteHeader(status)
+		w.Write(latin1(f.Corpo))
+	default:
+		// so atraso
+		return false
+	}
+	return true
+}
+
+// exportadados: identifica o export pelo codigo e confere a chave
+func (s *Server) handleExportadados(w http.ResponseWriter, r *http.Request) {
+	var p map[string]string
+	if err := json.Unmarshal([]byte(r.URL.Query().Get("parametro")), &p); err != nil {
+		escreverTexto(w, "Parametro invalido: "+err.Error())
+		return
+	}
+	s.mu.Lock()
+	tipo := ""
+	for t, e := range s.dados.Exports {
+		if e.Codigo == p["codigo"] {
+			tipo = t
+		}
+	}
+	export := s.dados.Exports[tipo]
+	principal := s.dados.EmpresaPrincipal
+	s.mu.Unlock()
+	if tipo == "" {
+		escreverTexto(w, "Não encontrado exporta dados codigo/Empresa")
+		return
+	}
+	if aplicarFalha(w, s.registrar(tipo), false) {
+		return
+	}
+	if p["chave"] != export.Chave {
+		escreverTexto(w, "Chave inválida")
+		return
+	}
+	// a hierarquia é consultada com o codigo da propria empresa
+	if tipo != AlvoHierarquia && p["empresa"] != principal {
+		escreverTexto(w, "Não encontrado exporta dados codigo/Empresa")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch tipo {
+	case AlvoEmpresas:
+		escreverJSON(w, s.dados.Empresas)
+	case AlvoSetores:
+		escreverJSON(w, s.dados.Setores)
+	case AlvoHierarquia:
+		h, ok := s.dados.Hierarquia[p["empresa"]]
+		if !ok {
+			escreverTexto(w, "Não encontrado exporta dados codigo/Empresa")
+			return
+		}
+		escreverJSON(w, h)
+	case AlvoFuncionarios:
+		lista := []Registro{}
+		for _, f := range s.dados.Funcionarios[p["empresaTrabalho"]] {
+			if p["cpf"] == "" || fmt.Sprint(f["CPFFUNCIONARIO"]) == p["cpf"] {
+				lista = append(lista, f)
+			}
+		}
+		escreverJSON(w, lista)
+	case AlvoAgendamentos:
+		inicio, err1 := time.Parse("02/01/2006", p["dataInicio"])
+		fim, err2 := time.Parse("02/01/2006", p["dataFim"])
+		if err1 != nil || err2 != nil {
+			escreverTexto(w, "Data inicial ou final invalida")
+			return
+		}
+		lista := []Registro{}
+		for _, a := range s.dados.Agendas[p["codigoAgenda"]] {
+			dia, err := time.Parse("02/01/2006", fmt.Sprint(a["data"]))
+			if err == nil && !dia.Before(inicio) && !dia.After(fim) {
+				lista = append(lista, a)
+			}
+		}
+		escreverJSON(w, lista)
+	default:
+		escreverJSON(w, []Registro{})
+	}
+}
+
+// AgendamentoWs: incluirAgendamento ocupa uma vaga livre da agenda em memoria, sem vaga responde Fault
+func (s *Server) handleAgendamentoWs(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		escreverTexto(w, "AgendamentoWs fake")
+		return
+	}
+	doc, ok := s.lerEnvelope(w, r)
+	if !ok {
+		return
+	}
+	op := doc.FindElement("//incluirAgendamento")
+	if op == nil {
+		escreverFault(w, "operação não suportada pelo fakesoc")
+		return
+	}
+	if aplicarFalha(w, s.registrar(AlvoIncluirAgendamento), true) {
+		return
+	}
+	dados := op.FindElement(".//dadosAgendamentoWsVo")
+	if dados == nil {
+		escreverFault(w, "dadosAgendamentoWsVo obrigatorio")
+		return
+	}
+	agenda := texto(dados, "codigoUsuarioAgenda")
+	data := texto(dados, "data")
+	hora := texto(dados, "horaInicial")
+	if _, err := time.Parse("02/01/2006", data); err != nil || agenda == "" || hora == "" {
+		escreverFault(w, "agenda, data e horaInicial sao obrigatorios")
+		return
+	}
+	// cada registro do export da agenda é uma vaga livre, o agendamento ocupa uma delas
+	s.mu.Lock()
+	vagas := s.dados.Agendas[agenda]
+	vaga := slices.IndexFunc(vagas, func(r Registro) bool {
+		return fmt.Sprint(r["data"]) == data && fmt.Sprint(r["horario"]) == hora
+	})
+	if vaga < 0 {
+		s.mu.Unlock()
+		escreverFault(w, fmt.Sprintf("nao ha vaga na agenda %s em %s %s", agenda, data, hora))
+		return
+	}
+	s.dados.Agendas[agenda] = slices.Delete(slices.Clone(vagas), vaga, vaga+1)
+	s.ocupados++
+	codigo := s.ocupados
+	s.mu.Unlock()
+	log.Printf("fakesoc: agendamento incluido na agenda %s em %s %s", agenda, data, hora)
+	escreverEnvelope(w, fmt.Sprintf(`<ns2:incluirAgendamentoResponse xmlns:ns2="http://services.soc.age.com/"><AgendamentoRetorno><codigoAgendamento>%d</codigoAgendamento><informacaoGeral><codigoMensagem>SOC-100</codigoMensagem><mensagem>Agendamento incluido</mensagem></informacaoGeral></AgendamentoRetorno></ns2:incluirAgendamentoResponse>`, codigo))
+}
+
+// FuncionarioModelo2Ws: importacaoFuncionario cria ou reaproveita o funcionario pelo cpf
+func (s *Server) handleFuncionarioWs(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		escreverTexto(w, "FuncionarioModelo2Ws fake")
+		return
+	}
+	doc, ok := s.lerEnvelope(w, r)
+	if !ok {
+		return
+	}
+	op := doc.FindElement("//importacaoFuncionario")
+	if op == nil {
+		escreverFault(w, "operação não suportada pelo fakesoc")
+		return
+	}
+	if aplicarFalha(w, s.registrar(AlvoImportacaoFuncionario), true) {
+		return
+	}
+	f := op.FindElement(".//funcionarioWsVo")
+	if f == nil {
+		escreverFault(w, "funcionarioWsVo obrigatorio")
+		return
+	}
+	empresa, cpf := texto(f, "codigoEmpresa"), texto(f, "cpf")
+	if empresa == "" || cpf == "" {
+		escreverFault(w, "codigoEmpresa e cpf sao obrigatorios")
+		return
+	}
+	cargo := ""
+	if c := op.FindElement(".//cargoWsVo"); c != nil {
+		cargo = texto(c, "nome")
+	}
+	s.mu.Lock()
+	codigo := ""
+	for _, existente := range s.dados.Funcionarios[empresa] {
+		if fmt.Sprint(existente["CPFFUNCIONARIO"]) == cpf {
+			codigo = fmt.Sprint(existente["CODIGO"])
+		}
+	}
+	if codigo == "" {
+		codigo = strconv.Itoa(s.dados.ProximoCodigoFuncionario)
+		s.dados.ProximoCodigoFuncionario++
+		s.dados.Funcionarios[empresa] = append(s.dados.Funcionarios[empresa], Registro{
+			"CODIGO":         codigo,
+			"NOME":           texto(f, "nomeFuncionario"),
+			"CPFFUNCIONARIO": cpf,
+			"NOMECARGO":      cargo,
+		})
+	}
+	s.mu.Unlock()
+	log.Printf("fakesoc: funcionario %s na empresa %s", codigo, empresa)
+	escreverEnvelope(w, `<ns2:importacaoFuncionarioResponse xmlns:ns2="http://services.soc.age.com/"><FuncionarioRetorno><codigoFuncionario>`+codigo+`</codigoFuncionario></FuncionarioRetorno></ns2:importacaoFuncionarioResponse>`)
+}
+
+// le o envelope SOAP e confere o UsernameToken com digest
+func (s *Server) lerEnvelope(w http.ResponseWriter, r *http.Request) (*etree.Document, bool) {
+	doc := etree.NewDocument()
+	if _, err := doc.ReadFrom(r.Body); err != nil {
+		escreverFault(w, "xml invalido: "+err.Error())
+		return nil, false
+	}
+	token := doc.FindElement("//Security/UsernameToken")
+	if token == nil {
+		escreverFault(w, "WS-Security obrigatorio")
+		return nil, false
+	}
+	s.mu.Lock()
+	usuario, senha := s.dados.Usuario, s.dados.Senha
+	s.mu.Unlock()
+	nonce, _ := base64.StdEncoding.DecodeString(texto(token, "Nonce"))
+	hash := sha1.Sum(append(nonce, []byte(texto(token, "Created")+senha)...))
+	if texto(token, "Username") != usuario || texto(token, "Password") != base64.StdEncoding.EncodeToString(hash[:]) {
+		escreverFault(w, "Usuário ou senha inválidos")
+		return nil, false
+	}
+	return doc, true
+}
+
+// texto do filho direto com o nome informado, ignorando o prefixo
+func texto(e *etree.Element, nome string) string {
+	if c := e.SelectElement(nome); c != nil {
+		return strings.TrimSpace(c.Text())
+	}
+	return ""
+}
+
+// falhas injetadas: GET lista, POST {"alvo": {...}} adiciona, DELETE limpa
+func (s *Server) handleFalhas(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		escreverJSON(w, s.falhas)
+	case http.MethodPost:
+		var novas map[string]Falha
+		if err := json.NewDecoder(r.Body).Decode(&novas); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for alvo, f := range novas {
+			s.SetFalha(alvo, f)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		s.LimparFalhas()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// volta ao estado das fixtures
+func (s *Server) handleReset(w http.ResponseWriter, r *http.Request) {
+	s.Reset()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// contagem de chamadas por alvo
+func (s *Server) handleChamadas(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	escreverJSON(w, s.chamadas)
+}
+
+// o SOC responde em ISO-8859-1
+func escreverJSON(w http.ResponseWriter, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json;charset=ISO-8859-1")
+	w.Write(latin1(string(data)))
+}
+
+// mensagens de erro do exportadados vem em texto com status 200
+func escreverTexto(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "text/plain;charset=ISO-8859-1")
+	w.Write(latin1(msg))
+}
+
+func escreverEnvelope(w http.ResponseWriter, corpo string) {
+	w.Header().Set("Content-Type", "text/xml;charset=utf-8")
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?><soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>%s</soap:Body></soap:Envelope>`, corpo)
+}
+
+func escreverFault(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "text/xml;charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(msg))
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?><soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault><faultcode>soap:Server</faultcode><faultstring>%s</faultstring><detail><ns1:WSException xmlns:ns1="http://services.soc.age.com/"/></detail></soap:Fault></soap:Body></soap:Envelope>`, b.String())
+}
+
+// converte para ISO-8859-1, caracteres fora da tabela viram "?"
+func latin1(s string) []byte {
+	out, err := charmap.ISO8859_1.NewEncoder().String(s)
+	if err != nil {
+		var b strings.Builder
+		for _, r := range s {
+			if _, ok := charmap.ISO8859_1.EncodeRune(r); ok {
+				b.WriteRune(r)
+			} else {
+				b.WriteByte('?')
+			}
+		}
+		out, _ = charmap.ISO8859_1.NewEncoder().String(b.String())
+	}
+	return []byte(out)
+}
+
+// copia profunda das fixtures resolvendo as datas relativas das agendas
+func copiarFixtures(f Fixtures, hoje time.Time) Fixtures {
+	data, _ := json.Marshal(f)
+	var c Fixtures
+	json.Unmarshal(data, &c)
+	if c.Hierarquia == nil {
+		c.Hierarquia = map[string][]Registro{}
+	}
+	if c.Funcionarios == nil {
+		c.Funcionarios = map[string][]Registro{}
+	}
+	if c.Agendas == nil {
+		c.Agendas = map[string][]Registro{}
+	}
+	for _, agenda := range c.Agendas {
+		for _, a := range agenda {
+			if d, ok := a["data"].(string); ok && strings.HasPrefix(d, "+") {
+				if n, err := strconv.Atoi(d[1:]); err == nil {
+					a["data"] = hoje.AddDate(0, 0, n).Format("02/01/2006")
+				}
+			}
+		}
+	}
+	return c
+}
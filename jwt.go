@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// erros da autenticação por jwt
+var (
+	ErrJWTDesabilitado = errors.New("autenticação por jwt não configurada")
+	ErrJWTInvalido     = errors.New("token jwt inválido")
+)
+
+// chaves carregadas do arquivo jwks, nil quando o jwt nao esta configurado
+var jwtKeys *jwkSet
+
+// uma chave do arquivo jwks
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// conjunto de chaves indexado pelo kid
+type jwkSet struct {
+	chaves map[string]any
+	algs   map[string]string
+}
+
+// claims aceitas no token do portal
+type jwtClaims struct {
+	Scope   string       `json:"scope"`
+	Scp     []string     `json:"scp"`
+	Empresa empresaClaim `json:"empresa"`
+	jwt.RegisteredClaims
+}
+
+// a claim empresa pode vir como texto, numero ou lista. fica nil so quando a claim nao veio,
+// presente e vazia ("empresa": [] ou null) vira uma lista vazia que nao libera nenhuma empresa
+type empresaClaim []string
+
+func (e *empresaClaim) UnmarshalJSON(data []byte) error {
+	var lista []json.Number
+	if err := json.Unmarshal(data, &lista); err == nil {
+		*e = make(empresaClaim, 0, len(lista))
+		for _, v := range lista {
+			*e = append(*e, v.String())
+		}
+		return nil
+	}
+	var listaTexto []string
+	if err := json.Unmarshal(data, &listaTexto); err == nil {
+		*e = listaTexto
+		return nil
+	}
+	var unico json.Number
+	if err := json.Unmarshal(data, &unico); err == nil {
+		*e = empresaClaim{unico.String()}
+		return nil
+	}
+	var texto string
+	if err := json.Unmarshal(data, &texto); err != nil {
+		return fmt.Errorf("claim empresa inválida: %s", data)
+	}
+	*e = empresaClaim{texto}
+	return nil
+}
+
+// le o arquivo jwks com chaves HS256 (oct) e RS256 (RSA)
+func loadJWKS(path string) (*jwkSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler jwks %s: %w", path, err)
+	}
+	var arquivo struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &arquivo); err != nil {
+		return nil, fmt.Errorf("erro ao interpretar jwks %s: %w", path, err)
+	}
+	set := &jwkSet{chaves: map[string]any{}, algs: map[string]string{}}
+	for i, k := range arquivo.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var chave any
+		var alg string
+		switch k.Kty {
+		case "oct":
+			segredo, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(k.K, "="))
+			if err != nil || len(segredo) == 0 {
+				return nil, fmt.Errorf("chave %d do jwks: segredo oct inválido", i)
+			}
+			chave, alg = segredo, "HS256"
+		case "RSA":
+			pub, err := parseRSAJWK(k)
+			if err != nil {
+				return nil, fmt.Errorf("chave %d do jwks: %w", i, err)
+			}
+			chave, alg = pub, "RS256"
+		default:
+			return nil, fmt.Errorf("chave %d do jwks: tipo %q não suportado", i, k.Kty)
+		}
+		if k.Alg != "" && k.Alg != alg {
+			return nil, fmt.Errorf("chave %d do jwks: algoritmo %q não suportado para %s", i, k.Alg, k.Kty)
+		}
+		if _, existe := set.chaves[k.Kid]; existe {
+			return nil, fmt.Errorf("chave %d do jwks: kid %q duplicado", i, k.Kid)
+		}
+		set.chaves[k.Kid] = chave
+		set.algs[k.Kid] = alg
+	}
+	if len(set.chaves) == 0 {
+		return nil, fmt.Errorf("jwks %s não possui chaves de assinatura", path)
+	}
+	return set, nil
+}
+
+// monta a chave publica rsa a partir do modulo e expoente
+func parseRSAJWK(k jwk) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(k.N, "="))
+	if err != nil || len(n) == 0 {
+		return nil, errors.New("modulo rsa inválido")
+	}
+	e, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(k.E, "="))
+	if err != nil || len(e) == 0 {
+		return nil, errors.New("expoente rsa inválido")
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
+
+// escolhe a chave do token pelo kid e confere se o algoritmo bate com ela
+func (s *jwkSet) keyfunc(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" && len(s.chaves) == 1 {
+		for k := range s.chaves {
+			kid = k
+		}
+	}
+	chave, ok := s.chaves[kid]
+	if !ok {
+		return nil, fmt.Errorf("kid %q desconhecido", kid)
+	}
+	if t.Method.Alg() != s.algs[kid] {
+		return nil, fmt.Errorf("algoritmo %s não permitido para o kid %q", t.Method.Alg(), kid)
+	}
+	return chave, nil
+}
+
+// valida o token e retorna o principal com os escopos e empresas liberadas
+func verifyJWT(token string) (*Principal, error) {
+	if jwtKeys == nil {
+		return nil, ErrJWTDesabilitado
+	}
+	opcoes := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"HS256", "RS256"}),
+		jwt.WithExpirationRequired(),
+	}
+	if cfg.Auth.JWTIssuer != "" {
+		opcoes = append(opcoes, jwt.WithIssuer(cfg.Auth.JWTIssuer))
+	}
+	if cfg.Auth.JWTAudience != "" {
+		opcoes = append(opcoes, jwt.WithAudience(cfg.Auth.JWTAudience))
+	}
+	var claims jwtClaims
+	if _, err := jwt.ParseWithClaims(token, &claims, jwtKeys.keyfunc, opcoes...); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrJWTInvalido, err)
+	}
+	escopos := claims.Scp
+	if claims.Scope != "" {
+		escopos = append(escopos, strings.Fields(claims.Scope)...)
+	}
+	return &Principal{
+		Tipo:     "jwt",
+		Tenant:   claims.Subject,
+		Escopos:  escopos,
+		Empresas: claims.Empresa,
+	}, nil
+}
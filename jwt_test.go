@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestEmpresaClaim(t *testing.T) {
+	casos := []struct {
+		nome     string
+		claims   string
+		empresas []string
+	}{
+		{"sem a claim", `{}`, nil},
+		{"texto", `{"empresa":"100"}`, []string{"100"}},
+		{"numero", `{"empresa":100}`, []string{"100"}},
+		{"lista de numeros", `{"empresa":[100,200]}`, []string{"100", "200"}},
+		{"lista de textos", `{"empresa":["100","200"]}`, []string{"100", "200"}},
+		{"lista vazia", `{"empresa":[]}`, []string{}},
+		{"nula", `{"empresa":null}`, []string{}},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			var claims jwtClaims
+			if err := json.Unmarshal([]byte(c.claims), &claims); err != nil {
+				t.Fatal(err)
+			}
+			if (claims.Empresa == nil) != (c.empresas == nil) || !slices.Equal(claims.Empresa, c.empresas) {
+				t.Errorf("empresa = %#v, esperava %#v", claims.Empresa, c.empresas)
+			}
+		})
+	}
+}
+
+func TestJWTComClaimEmpresaVaziaNaoLiberaEmpresas(t *testing.T) {
+	cfgAnterior := cfg
+	t.Cleanup(func() { cfg = cfgAnterior })
+	cfg = defaultConfig()
+	casos := []struct {
+		nome    string
+		claims  jwt.MapClaims
+		empresa string
+		permite bool
+	}{
+		{"sem a claim", jwt.MapClaims{"sub": "portal"}, "200", true},
+		{"empresa do token", jwt.MapClaims{"sub": "portal", "empresa": []string{"100"}}, "100", true},
+		{"outra empresa", jwt.MapClaims{"sub": "portal", "empresa": []string{"100"}}, "200", false},
+		{"claim vazia", jwt.MapClaims{"sub": "portal", "empresa": []string{}}, "200", false},
+		{"claim nula", jwt.MapClaims{"sub": "portal", "empresa": nil}, "200", false},
+	}
+	for _, c := range casos {
+		t.Run(c.nome, func(t *testing.T) {
+			principal, err := verifyJWT(tokenTeste(t, c.claims))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := principal.permiteEmpresa(c.empresa); got != c.permite {
+				t.Errorf("permiteEmpresa(%s) = %v com empresas %#v", c.empresa, got, principal.Empresas)
+			}
+		})
+	}
+}
@@ -2,86 +2,199 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/sha1"
 	"database/sql"
 	"encoding/base64"
 	"encoding/json"
 	"encoding/xml"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 	"unicode/utf8"
 
 	"github.com/beevik/etree"
 	_ "github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/net/html/charset"
 	"golang.org/x/text/encoding/charmap"
-	"golang.org/x/text/transform"
 )
 
+// pool de conexoes com o postgres
+var db *sql.DB
+
 func main() {
+	// arquivo de configuração opcional, as variaveis de ambiente tem prioridade
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "arquivo de configuração (.yaml, .yml ou .toml)")
+	flag.Parse()
+	var err error
+	cfg, err = loadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Erro ao carregar a configuração: %v", err)
+	}
+	log.Printf("SOC em ambiente %s (%s)", cfg.SOC.Ambiente, cfg.SOC.BaseURL)
+	// regras de capacidade das agendas, ja validadas no loadConfig
+	regrasCapacidade, err = montarCapacidade(cfg.Capacidade)
+	if err != nil {
+		log.Fatalf("Erro nas regras de capacidade: %v", err)
+	}
+	// cliente http compartilhado pelas chamadas ao SOC e ao Blip
+	upstreamClient = newUpstreamClient(cfg.Upstream)
+	if cfg.Upstream.Gravacao.Modo != "" {
+		gravacao, err := newGravacaoTransport(cfg.Upstream.Gravacao, upstreamClient.Transport)
+		if err != nil {
+			log.Fatalln("Erro ao configurar a gravação das chamadas externas - ERRO:", err)
+		}
+		upstreamClient.Transport = gravacao
+		log.Printf("chamadas externas em modo %s (%s)", cfg.Upstream.Gravacao.Modo, cfg.Upstream.Gravacao.Diretorio)
+	}
+	socExporta = &exportaDadosClient{baseURL: socURL(socCaminhoExportadados), client: upstreamClient}
+	// pool de conexoes compartilhado por toda a aplicação
+	db, err = sql.Open("postgres", cfg.Database.DSN)
+	if err != nil {
+		log.Fatalf("Erro ao abrir conexão com o banco: %v", err)
+	}
+	defer db.Close()
+	// comandos administrativos
+	if flag.Arg(0) == "apikey" {
+		if err := runAPIKeyCommand(flag.Args()[1:]); err != nil {
+			log.Fatalf("Erro no comando apikey: %v", err)
+		}
+		return
+	}
+	// chaves do jwt do portal, opcional
+	if cfg.Auth.JWKSFile != "" {
+		jwtKeys, err = loadJWKS(cfg.Auth.JWKSFile)
+		if err != nil {
+			log.Fatalf("Erro ao carregar o jwks: %v", err)
+		}
+	}
+	// criar a tabela de chaves de api se ja nao existe
+	if err := createAPIKeyTable(db); err != nil {
+		log.Printf("Erro ao criar tabela de chaves de api: %v", err)
+	}
+	// contexto cancelado ao receber SIGTERM ou SIGINT
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	// expediente das agendas, da configuração ou do banco
+	if err := atualizarExpediente(ctx, db); err != nil {
+		log.Printf("Erro ao carregar o expediente: %v", err)
+	}
+	// codigos das agendas por periodo, da configuração ou do banco
+	if err := atualizarRotasAgenda(ctx, db); err != nil {
+		log.Printf("Erro ao carregar as rotas das agendas: %v", err)
+	}
+	// exportador de spans do OpenTelemetry
+	shutdownTracing, err := setupTracing(ctx)
+	if err != nil {
+		log.Fatalf("Erro ao configurar o tracing: %v", err)
+	}
 	// Inicia a goroutine para rodar o workDatabase em paralelo
-	go workDatabase()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		workDatabase(ctx)
+	}()
 	// Configuração das rotas do servidor
-	http.HandleFunc("/api/v1/agendamento", handleAgendamento)
-	http.HandleFunc("/api/v1/empresa", handleGetCnpjs)
-	http.HandleFunc("/api/v1/setor", handleGetSetores)
-	http.HandleFunc("/api/v1/cargo", handleGetCargos)
-	http.HandleFunc("/api/v1/funcionario", handleGetCpfs)
-	http.HandleFunc("/api/v1/registrar", handleCriaFuncionario)
+	router := newRouter(rotasAPI())
+	server := &http.Server{
+		Addr:              cfg.Server.Addr,
+		Handler:           router,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
 	// Inicia o servidor HTTP
-	log.Println("Servidor iniciado na porta 2026...")
-	if err := http.ListenAndServe(":2026", nil); err != nil {
+	erroServidor := make(chan error, 1)
+	go func() {
+		log.Printf("Servidor iniciado em %s...", cfg.Server.Addr)
+		erroServidor <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-erroServidor:
 		// deu errado
 		log.Printf("Erro ao iniciar o servidor: %v", err)
+		stop()
+	case <-ctx.Done():
+		log.Println("Sinal de desligamento recebido, aguardando as requisições em andamento...")
+	}
+	// espera as requisições em andamento terminarem dentro do prazo
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Erro ao encerrar o servidor: %v", err)
+	}
+	wg.Wait()
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Printf("Erro ao encerrar o tracing: %v", err)
+	}
+	log.Println("Servidor encerrado")
+}
+
+// rotas do servidor, todas passam pela mesma pilha de middlewares
+func rotasAPI() []rota {
+	return []rota{
+		{"/api/v1/agendamento", handleAgendamento, map[string]string{"GET": "agendamento:read", "POST": "agendamento:write"}},
+		{"/api/v1/agendamento/proximos", handleProximosHorarios, map[string]string{"GET": "agendamento:read"}},
+		{"/api/v1/empresa", handleGetCnpjs, map[string]string{"": "empresa:read"}},
+		{"/api/v1/setor", handleGetSetores, map[string]string{"": "setor:read"}},
+		{"/api/v1/cargo", handleGetCargos, map[string]string{"": "cargo:read"}},
+		{"/api/v1/funcionario", handleGetCpfs, map[string]string{"": "funcionario:read"}},
+		{"/api/v1/registrar", handleCriaFuncionario, map[string]string{"": "funcionario:write"}},
+		{"/api/v1/admin/cache", handleInvalidarCache, map[string]string{"POST": "cache:write", "DELETE": "cache:write"}},
+		{"/healthz", handleHealthz, nil},
+		{"/readyz", handleReadyz, nil},
+		{"/metrics", handleMetrics, nil},
 	}
 }
 
 // handler de criar funcionario
 func handleCriaFuncionario(w http.ResponseWriter, r *http.Request) {
-	// verificar autenticação
-	if r.Header.Get("Authorization") != "TOKEN" {
-		log.Println("não autorizado")
-		http.Error(w, "não autorizado", http.StatusUnauthorized)
-		return
-	}
+	logger := requestLogger(r.Context())
 	// pega as variaveis necessario para a requisição dentro do body
 	// codigoCargo, nomeCargo, codigoEmpresa, cpf, dataNascimento, nomeFuncionario, codigoSetor, nomeSetor
 	bodyReq := r.Body
 	body, err := io.ReadAll(bodyReq)
 	if err != nil {
-		log.Printf("erro ao ler o corpo da requisição: %v", err)
-		http.Error(w, "erro ao ler o corpo da requisição", http.StatusInternalServerError)
+		logger.Printf("erro ao ler o corpo da requisição: %v", err)
+		writeError(w, r, newAPIError(http.StatusBadRequest, codigoCorpoInvalido, "erro ao ler o corpo da requisição"))
 		return
 	}
 	var funcionario FuncionarioReq
 	err = json.Unmarshal(body, &funcionario)
 	if err != nil {
-		log.Printf("erro ao trasnformar o body em variavel: %v", err)
-		http.Error(w, "erro ao trasnformar o body em variavel", http.StatusInternalServerError)
+		logger.Printf("erro ao trasnformar o body em variavel: %v", err)
+		writeError(w, r, newAPIError(http.StatusBadRequest, codigoCorpoInvalido, "corpo da requisição não é um json valido"))
 		return
 	}
 	if funcionario.Pis == "" {
-		log.Printf("erro ao criar o funcionario, pis inexistente")
-		http.Error(w, "erro ao criar o funcionario, pis inexistente", http.StatusBadRequest)
+		logger.Printf("erro ao criar o funcionario, pis inexistente")
+		writeError(w, r, newAPIError(http.StatusBadRequest, codigoParametrosInvalidos, "erro ao criar o funcionario, pis inexistente",
+			CampoErro{Campo: "pis", Mensagem: "campo obrigatório"}))
 		return
 	}
 	// criar o agendamento com os parametros da requisição
-	matriculaNova, err := createFuncionario(funcionario.CodigoCargo, funcionario.NomeCargo, funcionario.CodigoEmpresa, funcionario.CPF, funcionario.DataNascimento, funcionario.NomeFuncionario, funcionario.CodigoSetor, funcionario.NomeSetor, funcionario.RG, funcionario.Telefone, funcionario.NomeEmpresa, funcionario.CNPJEmpresa, funcionario.Pis)
+	matriculaNova, err := createFuncionario(r.Context(), funcionario.CodigoCargo, funcionario.NomeCargo, funcionario.CodigoEmpresa, funcionario.CPF, funcionario.DataNascimento, funcionario.NomeFuncionario, funcionario.CodigoSetor, funcionario.NomeSetor, funcionario.RG, funcionario.Telefone, funcionario.NomeEmpresa, funcionario.CNPJEmpresa, funcionario.Pis)
 	if err != nil {
-		log.Printf("erro ao criar o funcionario")
-		http.Error(w, "erro ao criar o funcionario", http.StatusBadRequest)
+		logger.Printf("erro ao criar o funcionario: %v", err)
+		writeError(w, r, socError(err, "erro ao criar o funcionario no SOC"))
 		return
 	}
 	if matriculaNova == "" {
-		log.Printf("matricula do funcionario nao encontrada")
-		http.Error(w, "matricula do funcionario nao encontrada", http.StatusBadRequest)
+		logger.Printf("matricula do funcionario nao encontrada")
+		writeError(w, r, newAPIError(http.StatusBadGateway, codigoErroSOC, "matricula do funcionario nao encontrada na resposta do SOC"))
 		return
 	}
 	// retornar se encontrou e se nao encontrou
@@ -89,20 +202,15 @@ func handleCriaFuncionario(w http.ResponseWriter, r *http.Request) {
 	// transforma todo o funcionario em json e retorna
 	err = json.NewEncoder(w).Encode(matriculaNova)
 	if err != nil {
-		log.Printf("Erro ao retornar o cnpj desejado: %v", err)
-		http.Error(w, `{"message": "Erro ao retornar o cnpj desejado"}`, http.StatusInternalServerError)
+		logger.Printf("Erro ao retornar o cnpj desejado: %v", err)
 		return
 	}
 }
 
 // handler do endpoint de agendamento para agendar, verificar data-hora,
 func handleAgendamento(w http.ResponseWriter, r *http.Request) {
-	// verificar autenticação
-	if r.Header.Get("Authorization") != "TOKEN" {
-		log.Println("não autorizado")
-		http.Error(w, "não autorizado", http.StatusUnauthorized)
-		return
-	}
+	logger := requestLogger(r.Context())
+	principal := principalFrom(r.Context())
 	switch r.Method {
 	case "POST": // cria agendamento
 		// tratar datas desta forma - dd/mm/aaaa
@@ -111,245 +219,165 @@ func handleAgendamento(w http.ResponseWriter, r *http.Request) {
 		compromisso := r.URL.Query().Get("compromisso")
 		empresa := r.URL.Query().Get("empresa")
 		codigoFuncionario := r.URL.Query().Get("matricula")
+		spanAttrs(r.Context(),
+			attribute.String("soc.empresa", empresa),
+			attribute.String("agendamento.data", dataParam),
+			attribute.String("agendamento.hora", hourParam),
+		)
 		// verificar se alguum parametros esta faltando
-		if !r.URL.Query().Has("data") || !r.URL.Query().Has("hora") || !r.URL.Query().Has("compromisso") || !r.URL.Query().Has("empresa") {
-			log.Printf("faltando parametros necessarios")
-			http.Error(w, "faltando parametros necessarios", http.StatusBadRequest)
+		if campos := camposObrigatorios(r.URL.Query(), "data", "hora", "compromisso", "empresa"); len(campos) > 0 {
+			logger.Printf("faltando parametros necessarios")
+			writeError(w, r, newAPIError(http.StatusBadRequest, codigoParametrosInvalidos, "faltando parametros necessarios", campos...))
 			return
 		}
-		supostoDiaAgend, err := time.Parse("02/01/2006", dataParam)
-		if err != nil {
-			log.Printf("Formato de data inválido: %v\n", err)
-			http.Error(w, "Formato de data inválido. Use o formato dd/mm/yyyy.", http.StatusBadRequest)
+		// verificar se o token pode agendar para a empresa
+		if status, err := autorizarEmpresa(principal, empresa); err != nil {
+			logger.Println("empresa não autorizada:", err)
+			writeError(w, r, newAPIError(status, codigoEmpresaNaoAutorizada, "empresa não autorizada"))
 			return
 		}
-		var codigoAgenda string
-		// Verificar se a data fornecida é antes de 31 de dezembro de 2024
-		dateLimit := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
-		if supostoDiaAgend.Before(dateLimit) {
-			codigoAgenda = "27295"
-		} else {
-			codigoAgenda = "3015983"
+		supostoDiaAgend, err := parseDia(dataParam)
+		if err != nil {
+			logger.Printf("Formato de data inválido: %v\n", err)
+			writeError(w, r, newAPIError(http.StatusBadRequest, codigoDataInvalida, "formato de data inválido, use dd/mm/aaaa",
+				CampoErro{Campo: "data", Mensagem: "use o formato dd/mm/aaaa"}))
+			return
 		}
+		// codigo da agenda clientes que vale no dia para o compromisso e a empresa
+		codigoAgenda := rotearAgenda(agendaClientes, supostoDiaAgend, filtroAgenda{compromisso: compromisso, empresa: empresa})
+		spanAttrs(r.Context(), attribute.String("soc.codigo_agenda", codigoAgenda))
 		// criar o agendamento com os parametros da requisição
-		err = createAgendamento(dataParam, hourParam, compromisso, empresa, codigoFuncionario, codigoAgenda)
+		err = createAgendamento(r.Context(), dataParam, hourParam, compromisso, empresa, codigoFuncionario, codigoAgenda)
 		if err != nil {
-			log.Printf("erro ao criar agendamento")
-			http.Error(w, "erro ao criar agendamento", http.StatusBadRequest)
+			logger.Printf("erro ao criar agendamento: %v", err)
+			writeError(w, r, socError(err, "erro ao criar agendamento no SOC"))
 			return
 		}
 
 	case "GET": // busca agendamentos
+		// com inicio a consulta é de um periodo, agrupada por dia
+		if r.URL.Query().Get("inicio") != "" {
+			handleDisponibilidadePeriodo(w, r)
+			return
+		}
 		// tratar datas desta forma - dd/mm/aaaa
 		dataParam := r.URL.Query().Get("data")
 		if dataParam == "" {
-			log.Println("data nao preenchido")
-			http.Error(w, "data nao preenchido", http.StatusBadRequest)
+			logger.Println("data nao preenchido")
+			writeError(w, r, newAPIError(http.StatusBadRequest, codigoParametrosInvalidos, "data ou inicio nao preenchido",
+				CampoErro{Campo: "data", Mensagem: "parâmetro obrigatório"}))
 			return
 		}
 		// se a hora existe é para verificar se esse horario esta disponivel
 		hourParam := r.URL.Query().Get("hora")
+		// compromisso e empresa opcionais escolhem a rota das agendas
+		filtro := filtroAgenda{compromisso: r.URL.Query().Get("compromisso"), empresa: r.URL.Query().Get("empresa")}
+		if !autorizarFiltroAgenda(w, r, filtro) {
+			return
+		}
+		spanAttrs(r.Context(),
+			attribute.String("agendamento.data", dataParam),
+			attribute.String("agendamento.hora", hourParam),
+		)
 		// varaivel para erro global
 		var err error
 		// formatar a data escolhida para agendamento como dd/mm/aaaa
-		supostoDiaAgend, err := time.Parse("02/01/2006", dataParam)
+		supostoDiaAgend, err := parseDia(dataParam)
 		if err != nil {
-			log.Printf("Formato de data inválido: %v\n", err)
-			http.Error(w, "Formato de data inválido. Use o formato dd/mm/yyyy.", http.StatusBadRequest)
+			logger.Printf("Formato de data inválido: %v\n", err)
+			writeError(w, r, newAPIError(http.StatusBadRequest, codigoDataInvalida, "formato de data inválido, use dd/mm/aaaa",
+				CampoErro{Campo: "data", Mensagem: "use o formato dd/mm/aaaa"}))
 			return
 		}
-		// verificar se o suposto supostoDiaAgend é um fim de semana
-		if supostoDiaAgend.Weekday() == time.Saturday || supostoDiaAgend.Weekday() == time.Sunday {
-			// fim de semana aqui
-			log.Println("Dia informado é final de semana")
-			http.Error(w, "Dia informado é final de semana", http.StatusBadRequest)
+		// horarios de trabalho das agendas no dia da semana pedido
+		horariosTrabalho := horariosTrabalhoDia(supostoDiaAgend.Weekday())
+		if len(horariosTrabalho) == 0 {
+			if supostoDiaAgend.Weekday() == time.Saturday || supostoDiaAgend.Weekday() == time.Sunday {
+				// fim de semana aqui
+				logger.Println("Dia informado é final de semana")
+				writeError(w, r, newAPIError(http.StatusBadRequest, codigoFimDeSemana, "dia informado é final de semana"))
+				return
+			}
+			logger.Println("Dia informado sem expediente")
+			writeError(w, r, newAPIError(http.StatusBadRequest, codigoDiaSemExpediente, "não há atendimento no dia informado"))
 			return
 		}
-		// Definir o início do período da pesquisa de agendamentos
-		diaInicio := strings.Split(dataParam, "/")[0] //fmt.Sprintf("%02d", now.Day())
-		mesInicio := strings.Split(dataParam, "/")[1] //fmt.Sprintf("%02d", now.Month())
-		anoInicio := strings.Split(dataParam, "/")[2] //fmt.Sprintf("%d", now.Year())
-		// now = now.AddDate(0, 0, 30) // Adiciona 30 dias ao início
-		diaFim := strings.Split(dataParam, "/")[0] //fmt.Sprintf("%02d", now.Day())
-		mesFim := strings.Split(dataParam, "/")[1] //fmt.Sprintf("%02d", now.Month())
-		anoFim := strings.Split(dataParam, "/")[2] //fmt.Sprintf("%d", now.Year())
-		// trazer todos os agendamentos do mes atual
-		log.Println("data inicio:", diaInicio, mesInicio, anoInicio)
-		log.Println("data fim", diaFim, mesFim, anoFim)
-		agendamentoResponse, err := getAgendamento(diaInicio, mesInicio, anoInicio, diaFim, mesFim, anoFim)
-		if err != nil {
-			log.Println("Erro ao buscar os agendamentos no SOC:", err)
-			http.Error(w, "Erro ao buscar os agendamentos no SOC", http.StatusInternalServerError)
+		// procurar pelos horarios ocupados o supostoDiaAgend
+		diaAgendamento := supostoDiaAgend.Format("02/01/2006")
+		logger.Println("data agendamento:", diaAgendamento)
+		// hora atual no fuso de Sao Paulo
+		now := agoraSaoPaulo()
+		hoje := now.Format("02/01/2006")
+		if diaPassado(supostoDiaAgend, now) {
+			logger.Println("dia informado é invalido -", diaAgendamento)
+			writeError(w, r, newAPIError(http.StatusBadRequest, codigoDiaPassado, "dia informado ja passou"))
 			return
 		}
-		horariosAgendaProteger, err := getAgendaProteger(diaInicio, mesInicio, anoInicio, diaFim, mesFim, anoFim)
+		// trazer os agendamentos das duas agendas e verificar o feriado ao mesmo tempo
+		consulta, err := consultarDia(r.Context(), supostoDiaAgend, filtro)
 		if err != nil {
-			log.Println("Erro ao buscar os agendamentos da Agenda Proteger no SOC:", err)
-			http.Error(w, "Erro ao buscar os agendamentos da Agenda Proteger no SOC", http.StatusInternalServerError)
+			logger.Println("Erro ao buscar os agendamentos no SOC:", err)
+			writeError(w, r, socError(err, "erro ao buscar os agendamentos no SOC"))
 			return
 		}
-		// inicialização do slice de horarios
-		var agendamentosLivres []Horario
-		// coloca os horarios de datas dentro do slice
-		err = json.Unmarshal(agendamentoResponse, &agendamentosLivres)
-		if err != nil {
-			log.Printf("Erro ao montar corpo da resposta SOC: %v", err)
-			http.Error(w, "Erro ao montar corpo da resposta SOC", http.StatusNotAcceptable)
+		// verificar se o dia informado é um feriado
+		if consulta.feriado {
+			logger.Println("não é possível agendar em feriados - ", diaAgendamento)
+			writeError(w, r, newAPIError(http.StatusBadRequest, codigoFeriado, "não é possível agendar em feriados"))
 			return
 		}
-		// inicialização do slice de horarios da agenda proteger
-		var agendamentosLivresAgendaProteger []Horario
-		// coloca os horarios de datas dentro do slice
-		err = json.Unmarshal(horariosAgendaProteger, &agendamentosLivresAgendaProteger)
+		agendamentosLivres, agendamentosLivresAgendaProteger := consulta.clientes, consulta.proteger
+		// registros livres e ocupados de cada agenda por horario no dia pedido
+		ocupacaoClientes, err := regraAgenda(agendaClientes).contar(agendamentosLivres)
 		if err != nil {
-			log.Printf("Erro ao montar corpo da resposta SOC com agenda Proteger: %v", err)
-			http.Error(w, "Erro ao montar corpo da resposta SOC com agenda Proteger", http.StatusNotAcceptable)
-			return
-		}
-		// procurar pelos horarios ocupados o supostoDiaAgend
-		diaAgendamento := supostoDiaAgend.Format("02/01/2006")
-		log.Println("data agendamento:", diaAgendamento)
-		// seta a location para o fuso de brasilia
-		location := time.FixedZone("GMT-3", -3*60*60)
-		// carrega a localização do brasil para o now
-		now := time.Now().In(location)
-		// Formatar como dd/mm/yyyy para comparar com diaAgendamento
-		hoje := now.Format("02/01/2006")
-		if supostoDiaAgend.Before(now.Truncate(24 * time.Hour)) {
-			log.Println(diaAgendamento)
-			log.Println(now.Truncate(24 * time.Hour))
-			log.Println("dia informado é invalido -", diaAgendamento)
-			http.Error(w, "dia invalido", http.StatusBadRequest)
+			logger.Printf("Formato de data inválido: %v\n", err)
+			writeError(w, r, newAPIError(http.StatusBadGateway, codigoErroSOC, "data inválida na resposta do SOC"))
 			return
 		}
-		// verificar se o dia informado é um feriado
-		if isHoliday(supostoDiaAgend) {
-			log.Println("não é possível agendar em feriados - ", diaAgendamento)
-			http.Error(w, "não é possível agendar em feriados", http.StatusBadRequest)
+		ocupacaoProteger, err := regraAgenda(agendaProteger).contar(agendamentosLivresAgendaProteger)
+		if err != nil {
+			logger.Printf("Formato de data inválido: %v\n", err)
+			writeError(w, r, newAPIError(http.StatusBadGateway, codigoErroSOC, "data inválida na resposta do SOC"))
 			return
 		}
-		// agenda clientes
-		// cria um map para armazenar os horarios que estao livres
-		horariosLivres := make(map[string]int)
-		horariosLivresAgendaProteger := make(map[string]int)
-		// itera sobre todos os horarios do slice
-		for _, dataHora := range agendamentosLivres {
-			// transformar o dataHora.Data em time.Time
-			dia, err := time.Parse("02/01/2006", dataHora.Data)
-			if err != nil {
-				log.Printf("Formato de data inválido: %v\n", err)
-				http.Error(w, "Formato de data inválido. Use o formato dd/mm/yyyy.", http.StatusBadRequest)
-				return
-			}
-			// verifica se tem agendamento para o dia do agendamento
-			if supostoDiaAgend.Equal(dia) {
-				// quantidade de agendamentos para cada agendamento
-				horariosLivres[dataHora.Horario]++
-			}
-		}
-		for _, dataHora := range agendamentosLivresAgendaProteger {
-			// transformar o dataHora.Data em time.Time
-			dia, err := time.Parse("02/01/2006", dataHora.Data)
-			if err != nil {
-				log.Printf("Formato de data inválido: %v\n", err)
-				http.Error(w, "Formato de data inválido. Use o formato dd/mm/yyyy.", http.StatusBadRequest)
-				return
-			}
-			// verifica se tem agendamento para o dia do agendamento
-			if supostoDiaAgend.Equal(dia) {
-				// quantidade de agendamentos para cada agendamento
-				horariosLivresAgendaProteger[dataHora.Horario]++
-			}
-		}
-		// precisa pegar o que esta entre cada horario e adicionar ao map
-		log.Println("map horarios livres:", horariosLivres)
-		log.Println("map horarios livres agenda proteger:", horariosLivresAgendaProteger)
-		// Horas que serao feitas os agendamentos
-		horariosTrabalho := []string{"07:30", "08:00", "08:30", "09:00", "09:30", "10:00", "10:30", "11:00", "11:30", "12:00", "12:30", "13:00", "13:30", "14:00", "14:30", "15:00", "15:30", "16:00", "16:30"}
-		// verificat quantos atendimentos ja estao marcados em cada agenda
-		novaListaHorariosLivres := make(map[string]int)
-		// verificar o horario para diferenciar a qtd de marcações
-		novaListaHorariosLivres[diaAgendamento] = 0
-		for _, horarioTrabalho := range horariosTrabalho {
-			if horariosLivresAgendaProteger[horarioTrabalho] == 3 {
-				// 2 horarios livre
-				novaListaHorariosLivres[diaAgendamento] += 1
-				continue
-			} else if horariosLivresAgendaProteger[horarioTrabalho] == 2 {
-				// 1 horarios livre
-				novaListaHorariosLivres[diaAgendamento] += 1
-				continue
-			} else {
-				// 0 horarios livre
-				continue
-			}
-		}
-		log.Println("Lista horarios livres Agenda Proteger:", novaListaHorariosLivres)
-
-		novaListaHorariosLivresAgendaClientes := make(map[string]int)
-		// verificar o horario para diferenciar a qtd de marcações
-		novaListaHorariosLivresAgendaClientes[diaAgendamento] = 0
-		for _, horarioTrabalho := range horariosTrabalho {
-			if horariosLivres[horarioTrabalho] > 5 {
-				horariosLivres[horarioTrabalho] = 5
-			}
-			// log.Printf("horario %s = %d", horarioTrabalho, horariosLivres[horarioTrabalho])
-			if horariosLivres[horarioTrabalho] == 5 {
-				// 5 horarios livre
-				novaListaHorariosLivresAgendaClientes[diaAgendamento] += 5
-				continue
-			} else if horariosLivres[horarioTrabalho] == 4 {
-				// 4 horarios livre
-				novaListaHorariosLivresAgendaClientes[diaAgendamento] += 4
-				continue
-			} else if horariosLivres[horarioTrabalho] == 3 {
-				// 3 horarios livre
-				novaListaHorariosLivresAgendaClientes[diaAgendamento] += 3
-				continue
-			} else if horariosLivres[horarioTrabalho] == 2 {
-				// 2 horarios livre
-				novaListaHorariosLivresAgendaClientes[diaAgendamento] += 2
-				continue
-			} else if horariosLivres[horarioTrabalho] == 1 {
-				// 1 horarios livre
-				novaListaHorariosLivresAgendaClientes[diaAgendamento] += 1
-				continue
-			} else {
-				// 0 horarios livre
-				continue
-			}
-		}
-		log.Println("Lista horarios livres Agenda Clientes:", novaListaHorariosLivresAgendaClientes)
+		horariosLivres, horariosLivresAgendaProteger := ocupacaoClientes[diaAgendamento], ocupacaoProteger[diaAgendamento]
+		logger.Println("map horarios livres:", horariosLivres)
+		logger.Println("map horarios livres agenda proteger:", horariosLivresAgendaProteger)
+		// vagas somadas de cada agenda no dia, so para acompanhamento
+		logger.Println("Vagas Agenda Proteger:", regraAgenda(agendaProteger).totalVagas(horariosAgenda(agendaProteger, supostoDiaAgend.Weekday()), horariosLivresAgendaProteger))
+		logger.Println("Vagas Agenda Clientes:", regraAgenda(agendaClientes).totalVagas(horariosAgenda(agendaClientes, supostoDiaAgend.Weekday()), horariosLivres))
 		// Cria slice para armazenar os horários disponíveis
 		var horariosDisponiveis []Horario
 		// verifica se existe o parametro de horario
 		if hourParam != "" {
 			// Verifica se o horário específico está disponível no dia fornecido
-			if horariosLivres[hourParam] > 0 && (horariosLivresAgendaProteger[hourParam] == 2 || horariosLivresAgendaProteger[hourParam] == 3) {
+			if slices.Contains(horariosTrabalho, hourParam) && !horarioPassado(supostoDiaAgend, hourParam, now) &&
+				horarioDisponivel(hourParam, horariosLivres, horariosLivresAgendaProteger) {
 				// horario esta disponivel
-				log.Println("Horario Disponivel")
-				w.Write([]byte("Horario Disponivel"))
+				logger.Println("Horario Disponivel")
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(Disponibilidade{Data: diaAgendamento, Horario: hourParam, Disponivel: true})
 				return
 			} else {
 				// horario nao disponivel
-				log.Println("Horario não esta disponivel")
-				http.Error(w, "false", http.StatusConflict)
+				logger.Println("Horario não esta disponivel")
+				writeError(w, r, newAPIError(http.StatusConflict, codigoHorarioIndisponivel, "horario não esta disponivel"))
 				return
 			}
 		} else {
 			// itera sobre cada horario de trabalho
-			log.Println("Dia Agendamento:", diaAgendamento)
-			log.Println("Hoje           :", hoje)
+			logger.Println("Dia Agendamento:", diaAgendamento)
+			logger.Println("Hoje           :", hoje)
 			for _, horario := range horariosTrabalho {
-				// verifica se é o dia do agendamento é hoje e se o hario ja passou
-				if diaAgendamento == hoje && horario <= now.Format("15:04") {
+				// verifica se o horario do dia do agendamento ja passou
+				if horarioPassado(supostoDiaAgend, horario, now) {
 					// Verificar se o horário já passou
-					log.Printf("Horário %s já passou, pulando...\n", horario)
+					logger.Printf("Horário %s já passou, pulando...\n", horario)
 					continue // Pula o horário que já passou
 				}
 				// Verifica dentro do map se o horario nao possui agendamentos
-				if horariosLivres[horario] > 0 && (horariosLivresAgendaProteger[horario] == 2 || horariosLivresAgendaProteger[horario] == 3) {
-					log.Println("horarios disponivel:", horario)
+				if horarioDisponivel(horario, horariosLivres, horariosLivresAgendaProteger) {
+					logger.Println("horarios disponivel:", horario)
 					// adiciona o horario para o slice de horarios disponiveis
 					horariosDisponiveis = append(horariosDisponiveis, Horario{
 						Data:    diaAgendamento,
@@ -363,41 +391,36 @@ func handleAgendamento(w http.ResponseWriter, r *http.Request) {
 		// transforma todo o array de horarios em json
 		err = json.NewEncoder(w).Encode(horariosDisponiveis)
 		if err != nil {
-			log.Printf("Erro ao retornar horários: %v", err)
-			http.Error(w, "Erro ao retornar horários", http.StatusInternalServerError)
+			logger.Printf("Erro ao retornar horários: %v", err)
 			return
 		}
 		//}
 	default:
-		log.Println("metodo nao suportado")
-		http.Error(w, "metodo nao suportado", http.StatusMethodNotAllowed)
+		logger.Println("metodo nao suportado")
+		writeError(w, r, newAPIError(http.StatusMethodNotAllowed, codigoMetodoNaoSuportado, "metodo nao suportado"))
 		return
 	}
 }
 
 // handler do endpoint de cnpj para buscar cnpj da empresa
 func handleGetCnpjs(w http.ResponseWriter, r *http.Request) {
-	// verificar autenticação
-	if r.Header.Get("Authorization") != "TOKEN" {
-		log.Println("não autorizado")
-		http.Error(w, `{"message": "não autorizado", "data": ""}`, http.StatusUnauthorized)
-		return
-	}
+	logger := requestLogger(r.Context())
 	// pegar o cnpj dos parametros
 	q := r.URL.Query()
 	cnpj := q.Get("cnpj")
 	cnpj = func(cnpj string) string { re := regexp.MustCompile(`[^\d]`); return re.ReplaceAllString(cnpj, "") }(cnpj)
 	// verificar se o cnpj esta no formato correto com 14 de length
 	if len(cnpj) > 14 {
-		log.Println("cnpj nao valido")
-		http.Error(w, `{"message": "cnpj nao valido", "data": ""}`, http.StatusBadRequest)
+		logger.Println("cnpj nao valido")
+		writeError(w, r, newAPIError(http.StatusBadRequest, codigoParametrosInvalidos, "cnpj nao valido",
+			CampoErro{Campo: "cnpj", Mensagem: "deve ter 14 digitos"}))
 		return
 	}
 	// pesquisar na funcao de fetchProductByCnpj com o cnpj formatado
-	empresa, err := fetchProductByCnpj(cnpj)
+	empresa, err := fetchProductByCnpj(r.Context(), cnpj)
 	if err != nil {
-		log.Printf("erro ao trazer cnpj com o valor recebido: %v", err)
-		http.Error(w, `{"message":"erro ao trazer cnpj com o valor recebido", "data": ""}`, http.StatusNotFound)
+		logger.Printf("erro ao trazer cnpj com o valor recebido: %v", err)
+		writeError(w, r, newAPIError(http.StatusNotFound, codigoNaoEncontrado, "empresa nao encontrada para o cnpj informado"))
 		return
 	}
 	// retornar se encontrou e se nao encontrou
@@ -405,26 +428,28 @@ func handleGetCnpjs(w http.ResponseWriter, r *http.Request) {
 	// transforma todo o funcionario em json e retorna
 	err = json.NewEncoder(w).Encode(empresa)
 	if err != nil {
-		log.Printf("Erro ao retornar o cnpj desejado: %v", err)
-		http.Error(w, `{"message": "Erro ao retornar o cnpj desejado"}`, http.StatusInternalServerError)
+		logger.Printf("Erro ao retornar o cnpj desejado: %v", err)
 		return
 	}
 }
 
 // handler para pequisar os cpf dentro do SOC
 func handleGetCpfs(w http.ResponseWriter, r *http.Request) {
-	// verificar autenticação
-	if r.Header.Get("Authorization") != "TOKEN" {
-		log.Println("não autorizado")
-		http.Error(w, `{"message": "não autorizado"}`, http.StatusUnauthorized)
-		return
-	}
+	logger := requestLogger(r.Context())
+	principal := principalFrom(r.Context())
 	// verificar o parametro do cpf da requisição
 	cpf := r.URL.Query().Get("cpf")
 	empresa := r.URL.Query().Get("empresa")
-	if !r.URL.Query().Has("cpf") || !r.URL.Query().Has("empresa") {
-		log.Printf("faltando parametros necessarios")
-		http.Error(w, `{"message": "faltando parametros necessarios"}`, http.StatusBadRequest)
+	spanAttrs(r.Context(), attribute.String("soc.empresa", empresa))
+	if campos := camposObrigatorios(r.URL.Query(), "cpf", "empresa"); len(campos) > 0 {
+		logger.Printf("faltando parametros necessarios")
+		writeError(w, r, newAPIError(http.StatusBadRequest, codigoParametrosInvalidos, "faltando parametros necessarios", campos...))
+		return
+	}
+	// verificar se o token pode consultar a empresa
+	if status, err := autorizarEmpresa(principal, empresa); err != nil {
+		logger.Println("empresa não autorizada:", err)
+		writeError(w, r, newAPIError(status, codigoEmpresaNaoAutorizada, "empresa não autorizada"))
 		return
 	}
 	//formatar o cpf para somente numeros
@@ -434,18 +459,18 @@ func handleGetCpfs(w http.ResponseWriter, r *http.Request) {
 		return cpf
 	}(cpf)
 	// procurar o cpf no SOC
-	body, err := getCpfSoc(empresa, cpf)
+	body, err := getCpfSoc(r.Context(), empresa, cpf)
 	if err != nil {
-		log.Println("Erro ao buscar cpf dentro do Soc:", err)
-		http.Error(w, "Erro ao buscar cpf dentro do Soc", http.StatusInternalServerError)
+		logger.Println("Erro ao buscar cpf dentro do Soc:", err)
+		writeError(w, r, socError(err, "erro ao buscar cpf dentro do SOC"))
 		return
 	}
-	//	log.Println(string(body))
+	//	logger.Println(string(body))
 	var funci []Funcionario
 	err = json.Unmarshal(body, &funci)
 	if err != nil {
-		log.Println("erro ao transformar a resposta em json")
-		http.Error(w, "erro ao transformar a resposta em json", http.StatusInternalServerError)
+		logger.Println("erro ao transformar a resposta em json")
+		writeError(w, r, newAPIError(http.StatusBadGateway, codigoErroSOC, "resposta do SOC em formato inesperado"))
 		return
 	}
 	// retornar se encontrou e se nao encontrou
@@ -453,33 +478,35 @@ func handleGetCpfs(w http.ResponseWriter, r *http.Request) {
 	// transforma todo o funcionario em json e retorna
 	err = json.NewEncoder(w).Encode(funci)
 	if err != nil {
-		log.Printf("Erro ao retornar o cpf desejado: %v", err)
-		http.Error(w, "Erro ao retornar o cpf desejado", http.StatusInternalServerError)
+		logger.Printf("Erro ao retornar o cpf desejado: %v", err)
 		return
 	}
 }
 
 // handler do endpoint de cargos
 func handleGetCargos(w http.ResponseWriter, r *http.Request) {
-	// Verificar autenticação
-	if r.Header.Get("Authorization") != "TOKEN" {
-		log.Println("não autorizado")
-		http.Error(w, "não autorizado", http.StatusUnauthorized)
-		return
-	}
+	logger := requestLogger(r.Context())
+	principal := principalFrom(r.Context())
 	// Pegar o ID da empresa e o setor nos parâmetros
 	empresa := r.URL.Query().Get("empresa")
 	setor := r.URL.Query().Get("setor")
-	if empresa == "" || setor == "" {
-		log.Println("empresa ou setor nao preenchido")
-		http.Error(w, "empresa ou setor nao preenchido", http.StatusBadRequest)
+	spanAttrs(r.Context(), attribute.String("soc.empresa", empresa), attribute.String("soc.setor", setor))
+	if campos := camposPreenchidos(r.URL.Query(), "empresa", "setor"); len(campos) > 0 {
+		logger.Println("empresa ou setor nao preenchido")
+		writeError(w, r, newAPIError(http.StatusBadRequest, codigoParametrosInvalidos, "empresa ou setor nao preenchido", campos...))
+		return
+	}
+	// verificar se o token pode consultar a empresa
+	if status, err := autorizarEmpresa(principal, empresa); err != nil {
+		logger.Println("empresa não autorizada:", err)
+		writeError(w, r, newAPIError(status, codigoEmpresaNaoAutorizada, "empresa não autorizada"))
 		return
 	}
 	// Buscar hierarquia no endpoint SOC
-	unit, err := fetchHierarquia(empresa)
+	unit, err := buscarHierarquia(r.Context(), empresa)
 	if err != nil {
-		log.Printf("erro ao trazer hierarquia de setores: %v", err)
-		http.Error(w, `{"message": "erro ao trazer hierarquia de setores"}`, http.StatusNotFound)
+		logger.Printf("erro ao trazer hierarquia de setores: %v", err)
+		writeError(w, r, socError(err, "erro ao trazer hierarquia de setores do SOC"))
 		return
 	}
 	// Filtrar cargos ativos do setor específico
@@ -488,7 +515,7 @@ func handleGetCargos(w http.ResponseWriter, r *http.Request) {
 		if unidade.NomeSetor == setor && unidade.AtivoSetor == "Sim" && unidade.AtivoCargo == "Sim" {
 			cargoUTF8, err := decodeToUTF8([]byte(unidade.NomeCargo))
 			if err != nil {
-				log.Printf("Erro ao converter para UTF-8: %v\n", err)
+				logger.Printf("Erro ao converter para UTF-8: %v\n", err)
 				continue
 			}
 			cargosAtivos = append(cargosAtivos, CargoResponse{
@@ -501,42 +528,43 @@ func handleGetCargos(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(cargosAtivos)
 	if err != nil {
-		log.Printf("Erro ao retornar cargos: %v", err)
-		http.Error(w, "Erro ao retornar cargos", http.StatusInternalServerError)
+		logger.Printf("Erro ao retornar cargos: %v", err)
 		return
 	}
 }
 
 // handler do endpoint de setores
 func handleGetSetores(w http.ResponseWriter, r *http.Request) {
-	// Verificar autenticação
-	if r.Header.Get("Authorization") != "TOKEN" {
-		log.Println("não autorizado")
-		http.Error(w, "não autorizado", http.StatusUnauthorized)
-		return
-	}
+	logger := requestLogger(r.Context())
+	principal := principalFrom(r.Context())
 	// Pegar o ID da empresa nos parâmetros
 	empresa := r.URL.Query().Get("empresa")
-	if empresa == "" {
-		log.Println("empresa nao preenchido")
-		http.Error(w, "empresa nao preenchido", http.StatusBadRequest)
+	spanAttrs(r.Context(), attribute.String("soc.empresa", empresa))
+	if campos := camposPreenchidos(r.URL.Query(), "empresa"); len(campos) > 0 {
+		logger.Println("empresa nao preenchido")
+		writeError(w, r, newAPIError(http.StatusBadRequest, codigoParametrosInvalidos, "empresa nao preenchida", campos...))
+		return
+	}
+	// verificar se o token pode consultar a empresa
+	if status, err := autorizarEmpresa(principal, empresa); err != nil {
+		logger.Println("empresa não autorizada:", err)
+		writeError(w, r, newAPIError(status, codigoEmpresaNaoAutorizada, "empresa não autorizada"))
 		return
 	}
 	// Buscar setores no endpoint SOC
-	setores, err := fetchSetorSOC()
+	setores, err := buscarSetores(r.Context(), empresa)
 	if err != nil {
-		log.Printf("erro ao trazer setores: %v", err)
-		http.Error(w, "erro ao trazer setores", http.StatusNotFound)
+		logger.Printf("erro ao trazer setores: %v", err)
+		writeError(w, r, socError(err, "erro ao trazer setores do SOC"))
 		return
 	}
-	// Filtrar setores da empresa específica e converter para array de objetos
+	// o buscarSetores ja devolve so os setores da empresa, aqui ficam os ativos
 	var setoresEmpresa []SetorResponse
-	// Filtrar setores da empresa específica
 	for _, v := range setores {
-		if v.CodigoEmpresa == empresa && v.SetorAtivo == "1" {
+		if v.SetorAtivo == "1" {
 			setorUTF8, err := decodeToUTF8([]byte(v.NomeSetor))
 			if err != nil {
-				log.Printf("Erro ao converter para UTF-8: %v\n", err)
+				logger.Printf("Erro ao converter para UTF-8: %v\n", err)
 				continue
 			}
 			setoresEmpresa = append(setoresEmpresa, SetorResponse{
@@ -549,132 +577,142 @@ func handleGetSetores(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(setoresEmpresa)
 	if err != nil {
-		log.Printf("Erro ao retornar setores: %v", err)
-		http.Error(w, "Erro ao retornar setores", http.StatusInternalServerError)
+		logger.Printf("Erro ao retornar setores: %v", err)
 		return
 	}
 }
 
-// funcao para rodar o populador do banco
-func workDatabase() {
-	// conexao com banco
-	connStr := "postgresstringconnection"
-	db, err := sql.Open("postgres", connStr)
-	if err != nil {
-		log.Println(err)
-	}
-	// fechar conexao apos execução
-	defer db.Close()
-
+// funcao para rodar o populador do banco, para quando o contexto é cancelado
+func workDatabase(ctx context.Context) {
 	for {
 		// funcao de testar conexao
-		if err = db.Ping(); err != nil {
+		if err := db.PingContext(ctx); err != nil {
 			log.Println(err)
 		}
 		// criar a tabela se ja nao existe
-		createProductTable(db)
+		createProductTable(ctx, db)
 
 		// sincronizar dados da API e banco
-		syncDataWithAPI(db)
+		syncDataWithAPI(ctx, db)
 
-		time.Sleep(20 * time.Hour)
+		// recarregar o expediente cadastrado no banco
+		if cfg.Expediente.Fonte == expedienteFontePostgres {
+			if err := atualizarExpediente(ctx, db); err != nil {
+				log.Printf("Erro ao recarregar o expediente: %v", err)
+			}
+		}
+		// recarregar as rotas das agendas cadastradas no banco
+		if cfg.RotasAgenda.Fonte == expedienteFontePostgres {
+			if err := atualizarRotasAgenda(ctx, db); err != nil {
+				log.Printf("Erro ao recarregar as rotas das agendas: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Sincronização de empresas encerrada")
+			return
+		case <-time.After(cfg.Database.SyncInterval):
+		}
 	}
 }
 
 // funcao de popular o banco com os dados do SOC
-func syncDataWithAPI(db *sql.DB) {
-	// verificar se os dados da api estao iguais
-	empSoc := getEmpresas()
+func syncDataWithAPI(ctx context.Context, db *sql.DB) {
 	// verificar os dados da tabela
-	empDb := fetchEmpresas(db)
+	empDb, err := fetchEmpresas(ctx, db)
+	if err != nil {
+		log.Printf("Erro ao buscar empresas no banco: %v", err)
+		registrarSincronizacao(err)
+		return
+	}
 	// mapear os produtos do banco de dados por CNPJ
 	empMap := make(map[string]bool)
 	// rodar nas empresas que estao no banco e adicionar true ao mapa pois estao no tabela
 	for _, prod := range empDb {
 		empMap[prod.CNPJ] = true
 	}
-	// rodar pelas empresas que retornaram do SOC
-	for _, empApi := range empSoc {
+	// trazer do SOC so as empresas que ainda nao estao no banco, filtrando durante a leitura
+	empSoc, err := getEmpresas(ctx, func(empApi *Empresa) bool {
 		// formatando cnpj igual ao banco
 		empApi.CNPJ = func(cnpj string) string {
 			re := regexp.MustCompile(`[^\d]`)
 			return re.ReplaceAllString(cnpj, "")
 		}(empApi.CNPJ)
-		// Se o CNPJ estiver vazio, continuar para a próxima iteração
-		if strings.TrimSpace(empApi.CNPJ) == "" {
-			// log.Println("CNPJ vazio, ignorando a empresa:", empApi.RazaoSocial)
-			continue
-		}
-		// Verificar se o CNPJ já existe no banco de dados
-		if !empMap[empApi.CNPJ] { // cnpj nao esta na tabela
-			log.Printf("Inserindo nova empresa: Razao: %s, Codigo: %s, Cnpj: %s\n", empApi.RazaoSocial, empApi.CodEmpresa, empApi.CNPJ)
-			// inserir o produto na tabela
-			_, err := insertProduct(db, empApi)
-			if err != nil {
-				log.Printf("Erro ao inserir produto: %v\n", err)
-			}
-			// log.Printf("Id inserido na tabela %d\n", id)
-			// Pausa por 5 segundo entre as inserções
-			time.Sleep(2 * time.Second)
+		// ignora CNPJ vazio ou que já existe no banco de dados
+		return strings.TrimSpace(empApi.CNPJ) != "" && !empMap[empApi.CNPJ]
+	})
+	if err != nil {
+		log.Printf("Erro ao buscar empresas no SOC: %v", err)
+		registrarSincronizacao(err)
+		return
+	}
+	// quantidade de empresas inseridas nesta execução
+	inseridas := 0
+	// rodar pelas empresas novas que retornaram do SOC
+	for _, empApi := range empSoc {
+		log.Printf("Inserindo nova empresa: Razao: %s, Codigo: %s, Cnpj: %s\n", empApi.RazaoSocial, empApi.CodEmpresa, empApi.CNPJ)
+		// inserir o produto na tabela
+		_, err := insertProduct(ctx, db, empApi)
+		if err != nil {
+			log.Printf("Erro ao inserir produto: %v\n", err)
 		} else {
-			// log.Printf("Empresa com CNPJ %s já existe, ignorando.\n", empApi.CNPJ)
+			inseridas++
+			empMap[empApi.CNPJ] = true
+		}
+		// Pausa por 2 segundos entre as inserções, interrompida no desligamento
+		select {
+		case <-ctx.Done():
+			registrarSincronizacao(ctx.Err())
+			return
+		case <-time.After(2 * time.Second):
 		}
 	}
+	syncEmpresasInseridas.Set(float64(inseridas))
+	registrarSincronizacao(nil)
 }
 
-// funcao de pegar as empresas do SOC
-func getEmpresas() []*Empresa {
-	url := "https://ws1.soc.com.br/WebSoc/exportadados?parametro={%27empresa%27:%27ID_EMPRESA%27,%27codigo%27:%27199197%27,%27chave%27:%2794666c79192a19a32dd5%27,%27tipoSaida%27:%27json%27,%27empresafiltro%27:%27%27,%27subgrupo%27:%27%27,%27socnet%27:%27%27,%27mostrarinativas%27:%27%27}"
-	method := "POST"
-	client := &http.Client{}
-	req, err := http.NewRequest(method, url, nil)
-	if err != nil {
-		log.Println("Erro ao criar requisição")
-		log.Println(err)
-	}
-	res, err := client.Do(req)
+// funcao de pegar as empresas do SOC, o export é lido em stream e so as empresas aceitas pelo filtro ficam na memoria
+func getEmpresas(ctx context.Context, manter func(*Empresa) bool) ([]*Empresa, error) {
+	parametro := paramEmpresas{exportaDadosBase: newExportaDadosBase(cfg.SOC.EmpresaPrincipal, cfg.SOC.Exportadados.Empresas)}
+	body, err := socExporta.abrir(ctx, upstreamGetEmpresas, parametro)
 	if err != nil {
-		log.Println("Erro ao realizar requisição")
-		log.Println(err)
+		log.Println("Erro ao realizar requisição:", err)
+		return nil, err
 	}
-	defer res.Body.Close()
-	// Lê o corpo da resposta como um stream de transformação, convertendo de ISO-8859-1 para UTF-8
-	reader := transform.NewReader(res.Body, charmap.ISO8859_1.NewDecoder())
-	// Lê o conteúdo transformado
-	body, err := io.ReadAll(reader)
+	defer body.Close()
+	empresas, err := decodificarLista(body, manter)
 	if err != nil {
-		log.Println("Erro ao ler corpo da resposta")
-		log.Println(err)
+		log.Println("Erro ao decodificar empresas:", err)
+		return nil, err
 	}
-	var empresas []*Empresa
-	err = json.Unmarshal(body, &empresas)
-	if err != nil {
-		log.Println("Erro ao unmarshal body")
-		log.Println(err)
+	lista := make([]*Empresa, len(empresas))
+	for i := range empresas {
+		lista[i] = &empresas[i]
 	}
-	return empresas
+	return lista, nil
 }
 
 // cria a tabela de empresas
-func createProductTable(db *sql.DB) {
+func createProductTable(ctx context.Context, db *sql.DB) {
 	query := `CREATE TABLE IF NOT EXISTS empresas (
     id SERIAL PRIMARY KEY,
     codigo BIGINT NOT NULL CHECK (codigo > 0),
     razao_social VARCHAR(150) NOT NULL,
     cnpj VARCHAR(18) NOT NULL
 );`
-	_, err := db.Exec(query)
+	_, err := db.ExecContext(ctx, query)
 	if err != nil {
 		log.Println(err)
 	}
 }
 
 // funcao que busca todos os produtos
-func fetchEmpresas(db *sql.DB) []*Empresa {
+func fetchEmpresas(ctx context.Context, db *sql.DB) ([]*Empresa, error) {
 	query := "SELECT codigo, razao_social, cnpj FROM empresas"
-	rows, err := db.Query(query)
+	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
-		log.Println(err)
+		return nil, err
 	}
 	defer rows.Close()
 	var empresas []*Empresa
@@ -687,13 +725,13 @@ func fetchEmpresas(db *sql.DB) []*Empresa {
 		empresas = append(empresas, &empresa)
 	}
 	if err = rows.Err(); err != nil {
-		log.Println(err)
+		return nil, err
 	}
-	return empresas
+	return empresas, nil
 }
 
 // funcao para inserir os dados na tabela
-func insertProduct(db *sql.DB, empresa *Empresa) (int, error) {
+func insertProduct(ctx context.Context, db *sql.DB, empresa *Empresa) (int, error) {
 	query := `INSERT INTO empresas (codigo, razao_social, cnpj) 
 	VALUES ($1, $2, $3) RETURNING id`
 	// Função anônima para limpar o CNPJ
@@ -702,19 +740,30 @@ func insertProduct(db *sql.DB, empresa *Empresa) (int, error) {
 		return re.ReplaceAllString(cnpj, "")
 	}(empresa.CNPJ)
 	var id int
-	err := db.QueryRow(query, empresa.CodEmpresa, strings.TrimSpace(empresa.RazaoSocial), empresa.CNPJ).Scan(&id)
+	err := db.QueryRowContext(ctx, query, empresa.CodEmpresa, strings.TrimSpace(empresa.RazaoSocial), empresa.CNPJ).Scan(&id)
 	if err != nil {
 		return 0, err
 	}
 	return id, nil
 }
 
-// função para verificar se a data é um feriado
-func isHoliday(date time.Time) bool {
-	const token string = "Key cm90ZWFkb3Jwcm90ZWdlcjpFTU9WR3JlcmRDRDdDcWtLRmcyNA=="
+// função para verificar se a data é um feriado, sem a lista do Blip nao da para saber e volta o erro
+// (quem chama aplica ErrFeriadosIndisponiveis)
+func isHoliday(ctx context.Context, date time.Time) (bool, error) {
+	diasFeriado, err := getFeriados(ctx, attribute.String("feriado.data", date.Format("02/01/2006")))
+	if err != nil {
+		return false, err
+	}
+	// Verifica se a data está em um dos intervalos de feriados
+	return isDateInIntervals(date, diasFeriado), nil
+}
+
+// funcao para buscar os feriados cadastrados no Blip
+func getFeriados(ctx context.Context, attrs ...attribute.KeyValue) ([][2]time.Time, error) {
+	token := "Key " + cfg.Blip.Key
 
 	feriados, err := func() ([]byte, error) {
-		url := "https://clinicaproteger.http.msging.net/commands"
+		url := cfg.Blip.URL
 		method := "POST"
 		payload := strings.NewReader(`
 			{
@@ -723,9 +772,8 @@ func isHoliday(date time.Time) bool {
     			"uri": "/resources/feriados"
 			}
 		`)
-		// cria o cliente e a requisição
-		client := &http.Client{}
-		req, err := http.NewRequest(method, url, payload)
+		// cria a requisição, o cliente http é o compartilhado
+		req, err := http.NewRequestWithContext(ctx, method, url, payload)
 		if err != nil {
 			log.Println("Erro ao montar a requisição - ERRO:", err)
 			return nil, err
@@ -734,7 +782,7 @@ func isHoliday(date time.Time) bool {
 		req.Header.Add("Content-Type", "application/json")
 		req.Header.Add("Authorization", token)
 		// realiza a requisição
-		res, err := client.Do(req)
+		res, err := doUpstream(upstreamBlipFeriados, upstreamClient, req, attrs...)
 		if err != nil {
 			log.Println("Erro ao realizar a requisição - ERRO:", err)
 			return nil, err
@@ -751,7 +799,7 @@ func isHoliday(date time.Time) bool {
 	// verifica se a funcao anonima retornou algum erro
 	if err != nil {
 		log.Printf("Erro ao trazer resources do Blip, Error: %v", err)
-		return false
+		return nil, err
 	}
 	// struct para lidar com os feriados resource
 	type responseBlip struct {
@@ -761,17 +809,16 @@ func isHoliday(date time.Time) bool {
 	err = json.Unmarshal(feriados, &resource)
 	if err != nil {
 		log.Println("Erro ao transformar a resposta - ERRO:", err)
-		return false
+		return nil, err
 	}
 	log.Println("Resource:", resource.Resource)
 	// Parse do retorno para intervalos de datas
 	diasFeriado, err := parseDateIntervals(resource.Resource)
 	if err != nil {
 		log.Println("Erro ao processar intervalos de feriados - ERRO:", err)
-		return false
+		return nil, err
 	}
-	// Verifica se a data está em um dos intervalos de feriados
-	return isDateInIntervals(date, diasFeriado)
+	return diasFeriado, nil
 }
 
 // funcao para processar a string e extrar os intervalos de datas
@@ -811,24 +858,10 @@ func isDateInIntervals(date time.Time, intervals [][2]time.Time) bool {
 }
 
 // funcao que busca somente um produto
-func fetchProductByCnpj(cnpj string) (*Empresa, error) {
-	// conexao com banco
-	connStr := "postgresstringconnection"
-	db, err := sql.Open("postgres", connStr)
-	if err != nil {
-		log.Println(err)
-		return nil, err
-	}
-	// fechar conexao apos execução
-	defer db.Close()
-	// funcao de testar conexao
-	if err = db.Ping(); err != nil {
-		log.Println(err)
-		return nil, err
-	}
+func fetchProductByCnpj(ctx context.Context, cnpj string) (*Empresa, error) {
 	query := "SELECT codigo, razao_social, cnpj FROM empresas WHERE cnpj = $1"
 	var empresa Empresa
-	err = db.QueryRow(query, cnpj).Scan(&empresa.CodEmpresa, &empresa.RazaoSocial, &empresa.CNPJ)
+	err := db.QueryRowContext(ctx, query, cnpj).Scan(&empresa.CodEmpresa, &empresa.RazaoSocial, &empresa.CNPJ)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			log.Printf("No rows found with this cnpj: %s\n", cnpj)
@@ -840,59 +873,38 @@ func fetchProductByCnpj(cnpj string) (*Empresa, error) {
 	return &empresa, nil
 }
 
-// funcao para trazer os setores do SOC
-func fetchSetorSOC() ([]Setor, error) {
-	url := "https://ws1.soc.com.br/WebSoc/exportadados?parametro={'empresa':'ID_EMPRESA','codigo':'CODIGO_FUNCAO','chave':'CHAVE_FUNCAO','tipoSaida':'json'}"
-	method := "POST"
-	client := &http.Client{}
-	req, err := http.NewRequest(method, url, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
-	res, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer res.Body.Close()
-
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, err
-	}
-	// Convertendo o body para UTF-8
-	utf8Body, err := decodeToUTF8(body)
+// funcao para trazer os setores de todas as empresas do SOC indexados pelo codigo da empresa,
+// o export vem com espaços no codigo e é montado durante a leitura
+func fetchSetoresSOC(ctx context.Context) (map[string][]Setor, error) {
+	parametro := paramSetores{exportaDadosBase: newExportaDadosBase(cfg.SOC.EmpresaPrincipal, cfg.SOC.Exportadados.Setores)}
+	body, err := socExporta.abrir(ctx, upstreamFetchSetorSOC, parametro)
 	if err != nil {
 		return nil, err
 	}
-	var setores []Setor
-	err = json.Unmarshal([]byte(utf8Body), &setores)
+	defer body.Close()
+	porEmpresa := make(map[string][]Setor)
+	_, err = decodificarLista(body, func(s *Setor) bool {
+		empresa := strings.TrimSpace(s.CodigoEmpresa)
+		porEmpresa[empresa] = append(porEmpresa[empresa], *s)
+		return false
+	})
 	if err != nil {
 		return nil, err
 	}
-	return setores, nil
+	return porEmpresa, nil
 }
 
 // funcao para pegar os cpfs
-func getCpfSoc(empresa, cpf string) ([]byte, error) {
-	url := "https://ws1.soc.com.br/WebSoc/exportadados?parametro={'empresa':'ID_EMPRESA','codigo':'CODIGO_FUNCAO','chave':'CHAVE_FUNCAO','tipoSaida':'json','empresaTrabalho':'" + empresa + "','cpf':'" + cpf + "','parametroData':'0','dataInicio':'','dataFim':''}"
-	method := "POST"
-	client := &http.Client{}
-	req, err := http.NewRequest(method, url, nil)
-	if err != nil {
-		log.Println("problema em criar a requisição")
-		return nil, err
-	}
-	res, err := client.Do(req)
+func getCpfSoc(ctx context.Context, empresa, cpf string) ([]byte, error) {
+	parametro := paramFuncionario{
+		exportaDadosBase: newExportaDadosBase(cfg.SOC.EmpresaPrincipal, cfg.SOC.Exportadados.Funcionarios),
+		EmpresaTrabalho:  empresa,
+		CPF:              cpf,
+		ParametroData:    "0",
+	}
+	body, err := socExporta.buscar(ctx, upstreamGetCpfSoc, parametro, attribute.String("soc.empresa", empresa))
 	if err != nil {
-		log.Println("erro ao realizar a requisição")
-		return nil, err
-	}
-	defer res.Body.Close()
-	// ler o corpo da resposta
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		log.Println("erro ao ler a resposta")
+		log.Println("erro ao realizar a requisição:", err)
 		return nil, err
 	}
 	// decodificando o corpo da resposta para utf8
@@ -905,30 +917,18 @@ func getCpfSoc(empresa, cpf string) ([]byte, error) {
 }
 
 // funcao para trazer a hierarquia dos setores-cargos
-func fetchHierarquia(empresa string) ([]Cargos_Setores, error) {
-	url := "https://ws1.soc.com.br/WebSoc/exportadados?parametro={'empresa':'" + empresa + "','codigo':'CODIGO_FUNCAO','chave':'CHAVE_FUNCAO','tipoSaida':'json'}"
-	method := "POST"
-	client := &http.Client{}
-	req, err := http.NewRequest(method, url, nil)
-	if err != nil {
-		return nil, err
-	}
-	res, err := client.Do(req)
+func fetchHierarquia(ctx context.Context, empresa string) ([]Cargos_Setores, error) {
+	parametro := paramHierarquia{exportaDadosBase: newExportaDadosBase(empresa, cfg.SOC.Exportadados.Hierarquia)}
+	body, err := socExporta.buscar(ctx, upstreamFetchHierarquia, parametro, attribute.String("soc.empresa", empresa))
 	if err != nil {
 		return nil, err
 	}
-	defer res.Body.Close()
-	// Lê o corpo da resposta como um stream de transformação, convertendo de ISO-8859-1 para UTF-8
-	reader := transform.NewReader(res.Body, charmap.ISO8859_1.NewDecoder())
-	body, err := io.ReadAll(reader)
+	// converte o corpo da resposta de ISO-8859-1 para UTF-8
+	body, err = charmap.ISO8859_1.NewDecoder().Bytes(body)
 	if err != nil {
 		log.Printf("erro ao ler o corpo da resposta: %v", err)
 		return nil, err
 	}
-	// Verificando se o body contém a mensagem de erro
-	if strings.Contains(string(body), "Não encontrado exporta dados codigo/Empresa") {
-		return nil, fmt.Errorf("erro: Não encontrado exporta dados codigo/Empresa")
-	}
 	// adicionando o retorno da requisição a uma variavel para lidarmos no codigo
 	var hierarquia []Cargos_Setores
 	err = json.Unmarshal(body, &hierarquia)
@@ -1022,9 +1022,9 @@ func createSOAPBody(date, hour, tipoCompromisso, empresa, codigoFuncionario, cod
 		agendamento := etree.NewElement("IncluirAgendamentoWsVo")
 		// Cria os elementos de identificação
 		identificacaoElem := etree.NewElement("identificacaoWsVo")
-		identificacaoElem.CreateElement("codigoEmpresaPrincipal").SetText("ID_EMPRESA")
-		identificacaoElem.CreateElement("codigoResponsavel").SetText("CODIGO_RESPONSAVEL")
-		identificacaoElem.CreateElement("codigoUsuario").SetText("COD_USUARIO")
+		identificacaoElem.CreateElement("codigoEmpresaPrincipal").SetText(cfg.SOC.EmpresaPrincipal)
+		identificacaoElem.CreateElement("codigoResponsavel").SetText(cfg.SOC.CodigoResponsavel)
+		identificacaoElem.CreateElement("codigoUsuario").SetText(cfg.SOC.CodigoUsuario)
 		agendamento.AddChild(identificacaoElem)
 		// Cria os elementos de agendamento
 		dadosElem := etree.NewElement("dadosAgendamentoWsVo")
@@ -1047,9 +1047,9 @@ func createSOAPBody(date, hour, tipoCompromisso, empresa, codigoFuncionario, cod
 		agendamento := etree.NewElement("IncluirAgendamentoWsVo")
 		// Cria os elementos de identificação
 		identificacaoElem := etree.NewElement("identificacaoWsVo")
-		identificacaoElem.CreateElement("codigoEmpresaPrincipal").SetText("ID_EMPRESA")
-		identificacaoElem.CreateElement("codigoResponsavel").SetText("CODIGO_RESPONSAVEL")
-		identificacaoElem.CreateElement("codigoUsuario").SetText("COD_USUARIO")
+		identificacaoElem.CreateElement("codigoEmpresaPrincipal").SetText(cfg.SOC.EmpresaPrincipal)
+		identificacaoElem.CreateElement("codigoResponsavel").SetText(cfg.SOC.CodigoResponsavel)
+		identificacaoElem.CreateElement("codigoUsuario").SetText(cfg.SOC.CodigoUsuario)
 		agendamento.AddChild(identificacaoElem)
 		// Cria os elementos de agendamento
 		dadosElem := etree.NewElement("dadosAgendamentoWsVo")
@@ -1073,7 +1073,7 @@ func createSOAPBody(date, hour, tipoCompromisso, empresa, codigoFuncionario, cod
 }
 
 // Função para enviar a requisição SOAP
-func sendSOAPRequest(soapBody, securityHeader *etree.Element) error {
+func sendSOAPRequest(ctx context.Context, soapBody, securityHeader *etree.Element) error {
 	doc := etree.NewDocument()
 	envelope := doc.CreateElement("soap:Envelope")
 	envelope.CreateAttr("xmlns:soap", "http://schemas.xmlsoap.org/soap/envelope/")
@@ -1098,16 +1098,15 @@ func sendSOAPRequest(soapBody, securityHeader *etree.Element) error {
 	// Imprimir a string XML para depuração
 	log.Println(xmlString)
 	// Enviar a requisição SOAP
-	url := "https://ws1.soc.com.br/WSoc/AgendamentoWs?wsdl"
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer([]byte(xmlString)))
+	url := socURL(socCaminhoAgendamentoWs)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer([]byte(xmlString)))
 	if err != nil {
 		log.Println("Error creating request:", err)
 		return err
 	}
-	// seta o header, o cliente e executa e a requisição
+	// seta o header e executa a requisição com o cliente compartilhado
 	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := doSOC(upstreamSOAPAgendamento, upstreamClient, req, false)
 	if err != nil {
 		log.Println("Error sending request:", err)
 		return err
@@ -1125,9 +1124,17 @@ func sendSOAPRequest(soapBody, securityHeader *etree.Element) error {
 }
 
 // funcao de criar agendamento
-func createAgendamento(date, hour, compromisso, empresa, codigoFuncionario, codigoAgenda string) error {
+func createAgendamento(ctx context.Context, date, hour, compromisso, empresa, codigoFuncionario, codigoAgenda string) (err error) {
+	ctx, span := tracer.Start(ctx, "createAgendamento", trace.WithAttributes(
+		attribute.String("soc.empresa", empresa),
+		attribute.String("agendamento.data", date),
+		attribute.String("agendamento.hora", hour),
+		attribute.String("agendamento.compromisso", compromisso),
+		attribute.String("soc.codigo_agenda", codigoAgenda),
+	))
+	defer func() { spanError(span, err); span.End() }()
 	// Cabeçalho de segurança
-	securityHeader := createWSSecurityHeader("USER", "PASSWORD")
+	securityHeader := createWSSecurityHeader(cfg.SOC.Usuario, cfg.SOC.Senha)
 	// Corpo da requisição SOAP
 	log.Println(date, hour, compromisso, empresa)
 	soapBody, err := createSOAPBody(date, hour, compromisso, empresa, codigoFuncionario, codigoAgenda)
@@ -1136,7 +1143,7 @@ func createAgendamento(date, hour, compromisso, empresa, codigoFuncionario, codi
 		return err
 	}
 	// Enviar a requisição
-	err = sendSOAPRequest(soapBody, securityHeader)
+	err = sendSOAPRequest(ctx, soapBody, securityHeader)
 	if err != nil {
 		log.Printf("Erro ao realizar requisição: %v", err)
 		return err
@@ -1146,9 +1153,15 @@ func createAgendamento(date, hour, compromisso, empresa, codigoFuncionario, codi
 }
 
 // criação de funcionario
-func createFuncionario(codigoCargo, nomeCargo, codigoEmpresa, cpf, dataNascimento, nomeFuncionario, codigoSetor, nomeSetor, rg, telefone, nomeEmpresa, cnpjEmpresa, pis string) (string, error) {
+func createFuncionario(ctx context.Context, codigoCargo, nomeCargo, codigoEmpresa, cpf, dataNascimento, nomeFuncionario, codigoSetor, nomeSetor, rg, telefone, nomeEmpresa, cnpjEmpresa, pis string) (_ string, err error) {
+	ctx, span := tracer.Start(ctx, "createFuncionario", trace.WithAttributes(
+		attribute.String("soc.empresa", codigoEmpresa),
+		attribute.String("soc.codigo_setor", codigoSetor),
+		attribute.String("soc.codigo_cargo", codigoCargo),
+	))
+	defer func() { spanError(span, err); span.End() }()
 	// Cabeçalho de segurança
-	securityHeader := createWSSecurityHeader("USER", "PASSWORD")
+	securityHeader := createWSSecurityHeader(cfg.SOC.Usuario, cfg.SOC.Senha)
 	// Corpo da requisição SOAP
 	log.Println()
 	soapBody, err := createSOAPBodyFuncionario(codigoCargo, nomeCargo, codigoEmpresa, cpf, dataNascimento, nomeFuncionario, codigoSetor, nomeSetor, rg, telefone, nomeEmpresa, cnpjEmpresa, pis)
@@ -1157,7 +1170,7 @@ func createFuncionario(codigoCargo, nomeCargo, codigoEmpresa, cpf, dataNasciment
 		return "", err
 	}
 	// Enviar a requisição
-	createResponse, err := sendSOAPRequestFuncionario(soapBody, securityHeader)
+	createResponse, err := sendSOAPRequestFuncionario(ctx, soapBody, securityHeader)
 	if err != nil {
 		log.Printf("Erro ao realizar requisição: %v", err)
 		return "", err
@@ -1192,9 +1205,9 @@ func createSOAPBodyFuncionario(codigoCargo, nomeCargo, codigoEmpresa, cpf, dataN
 	// Cria os elementos de identificação
 	identificacaoElem := etree.NewElement("identificacaoWsVo")
 	identificacaoElem.CreateElement("chaveAcesso").SetText(" ") // 	A informação pode ser consultada nas configurações de integração no cadastro de Empresa
-	identificacaoElem.CreateElement("codigoEmpresaPrincipal").SetText("ID_EMPRESA")
-	identificacaoElem.CreateElement("codigoResponsavel").SetText("CODIGO_REPONSAVEL")
-	identificacaoElem.CreateElement("codigoUsuario").SetText("COD_USUARIO")
+	identificacaoElem.CreateElement("codigoEmpresaPrincipal").SetText(cfg.SOC.EmpresaPrincipal)
+	identificacaoElem.CreateElement("codigoResponsavel").SetText(cfg.SOC.CodigoResponsavel)
+	identificacaoElem.CreateElement("codigoUsuario").SetText(cfg.SOC.CodigoUsuario)
 	funcionario.AddChild(identificacaoElem)
 	// Cria os elementos do cargo
 	dadosCargo := etree.NewElement("cargoWsVo")
@@ -1274,7 +1287,7 @@ func formataCNPJ(cnpj string) string {
 }
 
 // Função para enviar a requisição SOAP
-func sendSOAPRequestFuncionario(soapBody, securityHeader *etree.Element) ([]byte, error) {
+func sendSOAPRequestFuncionario(ctx context.Context, soapBody, securityHeader *etree.Element) ([]byte, error) {
 	doc := etree.NewDocument()
 	envelope := doc.CreateElement("soapenv:Envelope")
 	envelope.CreateAttr("xmlns:soapenv", "http://schemas.xmlsoap.org/soap/envelope/")
@@ -1299,16 +1312,15 @@ func sendSOAPRequestFuncionario(soapBody, securityHeader *etree.Element) ([]byte
 	// Imprimir a string XML para depuração
 	log.Println("Request:", xmlString)
 	// Enviar a requisição SOAP
-	url := "https://ws1.soc.com.br/WSoc/FuncionarioModelo2Ws?wsdl"
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer([]byte(xmlString)))
+	url := socURL(socCaminhoFuncionarioWs)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer([]byte(xmlString)))
 	if err != nil {
 		log.Println("Error creating request:", err)
 		return nil, err
 	}
-	// seta o header, o cliente e executa e a requisição
+	// seta o header e executa a requisição com o cliente compartilhado
 	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := doSOC(upstreamSOAPFuncionario, upstreamClient, req, false)
 	if err != nil {
 		log.Println("Error sending request:", err)
 		return nil, err
@@ -1327,56 +1339,50 @@ func sendSOAPRequestFuncionario(soapBody, securityHeader *etree.Element) ([]byte
 // pegar agendamentos requisição
 
 // funcao para pesquisar os agendamentos dentro do SOC
-func getAgendamento(diaInicio, mesInicio, anoInicio, diaFim, mesFim, anoFim string) ([]byte, error) {
-	url := "https://ws1.soc.com.br/WebSoc/exportadados?parametro={'empresa':'ID_EMPRESA','codigo':'CODIGO_FUNCAO','chave':'CHAVE_FUNCAO','tipoSaida':'json','empresaTrabalho':'ID_EMPRESA','dataInicio':'" + diaInicio + "%2F" + mesInicio + "%2F" + anoInicio + "','dataFim':'" + diaFim + "%2F" + mesFim + "%2F" + anoFim + "','codigoAgenda':'3015983','statusAgendaFiltro':''}"
-	method := "POST"
-	payload := strings.NewReader(``)
-	// criar o client que executara a requisição e a requisição
-	client := &http.Client{}
-	req, err := http.NewRequest(method, url, payload)
-	if err != nil {
-		log.Printf("Erro ao criar requisição: %v", err)
-		return nil, err
-	}
-	// executar a requisição
-	res, err := client.Do(req)
-	if err != nil {
-		log.Printf("Erro ao realizar requisição: %v", err)
-		return nil, err
+func getAgendamento(ctx context.Context, inicio, fim time.Time, filtro filtroAgenda) ([]byte, error) {
+	return buscarAgendaRoteada(ctx, upstreamGetAgendamento, agendaClientes, inicio, fim, filtro)
+}
+
+// funcao para pesquisar os agendamentos da agenda Proteger dentro do SOC
+func getAgendaProteger(ctx context.Context, inicio, fim time.Time, filtro filtroAgenda) ([]byte, error) {
+	return buscarAgendaRoteada(ctx, upstreamGetAgendaProteger, agendaProteger, inicio, fim, filtro)
+}
+
+// busca a agenda no periodo com uma chamada por codigo de agenda que vale nele
+func buscarAgendaRoteada(ctx context.Context, nome, agenda string, inicio, fim time.Time, filtro filtroAgenda) ([]byte, error) {
+	var listas [][]byte
+	for _, trecho := range trechosAgenda(agenda, inicio, fim, filtro) {
+		body, err := buscarAgenda(ctx, nome, trecho.codigo, trecho.inicio, trecho.fim)
+		if err != nil {
+			return nil, err
+		}
+		listas = append(listas, body)
 	}
-	defer res.Body.Close()
-	// ler o corpo da requisição
-	body, err := io.ReadAll(res.Body)
+	body, err := juntarListas(listas)
 	if err != nil {
-		log.Printf("Erro ao ler corpo da requisição SOC: %v", err)
-		return nil, err
+		return nil, fmt.Errorf("resposta do SOC em formato inesperado: %w", err)
 	}
 	return body, nil
 }
-func getAgendaProteger(diaInicio, mesInicio, anoInicio, diaFim, mesFim, anoFim string) ([]byte, error) {
-	url := "https://ws1.soc.com.br/WebSoc/exportadados?parametro={'empresa':'ID_EMPRESA','codigo':'CODIGO_FUNCAO','chave':'CHAVE_FUNCAO','tipoSaida':'json','empresaTrabalho':'ID_EMPRESA','dataInicio':'" + diaInicio + "%2F" + mesInicio + "%2F" + anoInicio + "','dataFim':'" + diaFim + "%2F" + mesFim + "%2F" + anoFim + "','codigoAgenda':'COD_AGENDA','statusAgendaFiltro':''}"
-	method := "POST"
-	payload := strings.NewReader(``)
-	// criar o client que executara a requisição e a requisição
-	client := &http.Client{}
-	req, err := http.NewRequest(method, url, payload)
-	if err != nil {
-		log.Printf("Erro ao criar requisição: %v", err)
-		return nil, err
-	}
-	// executar a requisição
-	res, err := client.Do(req)
+
+// busca os agendamentos de uma agenda no periodo informado
+func buscarAgenda(ctx context.Context, nome, codigoAgenda string, inicio, fim time.Time) ([]byte, error) {
+	parametro := paramAgendamentos{
+		exportaDadosBase: newExportaDadosBase(cfg.SOC.EmpresaPrincipal, cfg.SOC.Exportadados.Agendamentos),
+		EmpresaTrabalho:  cfg.SOC.EmpresaPrincipal,
+		DataInicio:       socData(inicio),
+		DataFim:          socData(fim),
+		CodigoAgenda:     codigoAgenda,
+	}
+	body, err := socExporta.buscar(ctx, nome, parametro,
+		attribute.String("soc.data_inicio", parametro.DataInicio),
+		attribute.String("soc.data_fim", parametro.DataFim),
+		attribute.String("soc.codigo_agenda", codigoAgenda),
+	)
 	if err != nil {
 		log.Printf("Erro ao realizar requisição: %v", err)
 		return nil, err
 	}
-	defer res.Body.Close()
-	// ler o corpo da requisição
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		log.Printf("Erro ao ler corpo da requisição SOC: %v", err)
-		return nil, err
-	}
 	return body, nil
 }
 
@@ -1384,6 +1390,14 @@ func getAgendaProteger(diaInicio, mesInicio, anoInicio, diaFim, mesFim, anoFim s
 type Horario struct {
 	Data    string `json:"data"`
 	Horario string `json:"horario"`
+	Status  string `json:"status,omitempty"`
+}
+
+// resposta da verificação de um horario especifico
+type Disponibilidade struct {
+	Data       string `json:"data"`
+	Horario    string `json:"horario"`
+	Disponivel bool   `json:"disponivel"`
 }
 
 // funcionario strutura
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// nomes das chamadas externas usados como label nas metricas
+const (
+	upstreamGetAgendamento    = "getAgendamento"
+	upstreamGetAgendaProteger = "getAgendaProteger"
+	upstreamFetchSetorSOC     = "fetchSetorSOC"
+	upstreamFetchHierarquia   = "fetchHierarquia"
+	upstreamGetCpfSoc         = "getCpfSoc"
+	upstreamGetEmpresas       = "getEmpresas"
+	upstreamSOAPAgendamento   = "soap_agendamento"
+	upstreamSOAPFuncionario   = "soap_funcionario"
+	upstreamBlipFeriados      = "blip_feriados"
+	upstreamSOCProbe          = "soc_probe"
+)
+
+// registro proprio para nao misturar com o registro global
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Total de requisições recebidas por rota, metodo e status.",
+	}, []string{"rota", "metodo", "status"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Duração das requisições recebidas por rota, metodo e status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"rota", "metodo", "status"})
+
+	upstreamRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "upstream_requests_total",
+		Help: "Total de chamadas ao SOC e ao Blip por chamada e resultado (ok, erro_http, erro_rede).",
+	}, []string{"upstream", "resultado"})
+
+	upstreamRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "upstream_request_duration_seconds",
+		Help:    "Duração das chamadas ao SOC e ao Blip até a resposta.",
+		Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"upstream"})
+
+	upstreamRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "upstream_retries_total",
+		Help: "Total de novas tentativas de chamadas ao SOC.",
+	}, []string{"upstream"})
+
+	upstreamCircuitOpen = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "upstream_circuit_open",
+		Help: "1 quando o disjuntor do endpoint do SOC esta aberto.",
+	}, []string{"upstream"})
+
+	cacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_requests_total",
+		Help: "Consultas ao cache dos exports do SOC por cache e resultado (hit, miss).",
+	}, []string{"cache", "resultado"})
+
+	syncLastSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sync_last_success_timestamp_seconds",
+		Help: "Horario unix da ultima sincronização de empresas concluida.",
+	})
+
+	syncEmpresasInseridas = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sync_empresas_inseridas",
+		Help: "Quantidade de empresas inseridas na ultima sincronização.",
+	})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequestsTotal,
+		httpRequestDuration,
+		upstreamRequestsTotal,
+		upstreamRequestDuration,
+		upstreamRetries,
+		upstreamCircuitOpen,
+		cacheRequests,
+		syncLastSuccess,
+		syncEmpresasInseridas,
+	)
+}
+
+// handler do /metrics
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// conta e mede as requisições de cada rota
+func withMetrics(route string) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			inicio := time.Now()
+			rec, ok := w.(*statusRecorder)
+			if !ok {
+				rec = &statusRecorder{ResponseWriter: w}
+			}
+			next.ServeHTTP(rec, r)
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			labels := prometheus.Labels{"rota": route, "metodo": r.Method, "status": strconv.Itoa(status)}
+			httpRequestsTotal.With(labels).Inc()
+			httpRequestDuration.With(labels).Observe(time.Since(inicio).Seconds())
+		})
+	}
+}
+
+// executa a chamada externa registrando duração, resultado e um span de cliente
+func doUpstream(nome string, client *http.Client, req *http.Request, attrs ...attribute.KeyValue) (*http.Response, error) {
+	attrs = append(attrs,
+		semconv.HTTPRequestMethodKey.String(req.Method),
+		semconv.ServerAddress(req.URL.Hostname()),
+	)
+	ctx, span := tracer.Start(req.Context(), nome, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	defer span.End()
+	req = req.WithContext(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	inicio := time.Now()
+	res, err := client.Do(req)
+	upstreamRequestDuration.WithLabelValues(nome).Observe(time.Since(inicio).Seconds())
+	resultado := "ok"
+	if err != nil {
+		resultado = "erro_rede"
+		spanError(span, erroSemQuery(err))
+	} else {
+		span.SetAttributes(semconv.HTTPResponseStatusCode(res.StatusCode))
+		if res.StatusCode >= 400 {
+			resultado = "erro_http"
+			span.SetStatus(codes.Error, res.Status)
+		}
+	}
+	upstreamRequestsTotal.WithLabelValues(nome, resultado).Inc()
+	return res, err
+}
+
+// o *url.Error traz a url completa e o parametro do exportadados leva a chave do SOC,
+// o erro gravado no span fica so com o caminho
+func erroSemQuery(err error) error {
+	var uerr *url.Error
+	if !errors.As(err, &uerr) {
+		return err
+	}
+	caminho := "url inválida"
+	if u, errParse := url.Parse(uerr.URL); errParse == nil {
+		caminho = u.Scheme + "://" + u.Host + u.Path
+	}
+	return fmt.Errorf("%s %s: %w", uerr.Op, caminho, uerr.Err)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestDoUpstreamNaoGravaChaveNoSpan(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+
+	// servidor ja fechado para a chamada falhar com *url.Error
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	parametro := url.Values{"parametro": {`{"empresa":"100","codigo":"1005","chave":"chave-secreta"}`}}
+	req, err := http.NewRequest("POST", srv.URL+"/WebSoc/exportadados?"+parametro.Encode(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doUpstream(upstreamGetAgendamento, http.DefaultClient, req); err == nil {
+		t.Fatal("esperava erro de conexão")
+	}
+
+	finalizados := spans.Ended()
+	if len(finalizados) != 1 {
+		t.Fatalf("esperava 1 span, veio %d", len(finalizados))
+	}
+	span := finalizados[0]
+	textos := []string{span.Status().Description}
+	for _, ev := range span.Events() {
+		for _, attr := range ev.Attributes {
+			textos = append(textos, attr.Value.Emit())
+		}
+	}
+	for _, texto := range textos {
+		if strings.Contains(texto, "chave-secreta") || strings.Contains(texto, "parametro") {
+			t.Errorf("span com a query do exportadados: %q", texto)
+		}
+	}
+	if !strings.Contains(span.Status().Description, "/WebSoc/exportadados") {
+		t.Errorf("status do span sem o caminho da chamada: %q", span.Status().Description)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// header usado para receber e devolver o id da requisição
+const requestIDHeader = "X-Request-ID"
+
+// chaves dos valores guardados no contexto da requisição
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	principalKey
+)
+
+// um middleware recebe o proximo handler e devolve outro
+type middleware func(http.Handler) http.Handler
+
+// aplica os middlewares na ordem, o primeiro é o mais externo
+func chain(h http.Handler, ms ...middleware) http.Handler {
+	for i := len(ms) - 1; i >= 0; i-- {
+		h = ms[i](h)
+	}
+	return h
+}
+
+// rota da api com os escopos exigidos por metodo, a chave "" vale para qualquer metodo,
+// escopos nil deixa a rota publica
+type rota struct {
+	path    string
+	handler http.HandlerFunc
+	escopos map[string]string
+}
+
+// monta o mux com a mesma pilha de middlewares em todas as rotas
+func newRouter(rotas []rota) *http.ServeMux {
+	mux := http.NewServeMux()
+	for _, rt := range rotas {
+		ms := []middleware{
+			withRequestID,
+			withTracing(rt.path),
+			withAccessLog(rt.path),
+			withMetrics(rt.path),
+			withRecover,
+		}
+		if rt.escopos != nil {
+			ms = append(ms, withAuth(rt.escopos))
+		}
+		mux.Handle(rt.path, chain(rt.handler, ms...))
+	}
+	return mux
+}
+
+// gera ou propaga o id da requisição e devolve ele no header da resposta
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// aceita somente ids curtos e com caracteres visiveis vindos do cliente
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// gera um id aleatorio para a requisição
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// id da requisição guardado no contexto
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// logger com o id da requisição como prefixo
+func requestLogger(ctx context.Context) *log.Logger {
+	id := requestIDFrom(ctx)
+	if id == "" {
+		return log.Default()
+	}
+	return log.New(log.Writer(), "["+id+"] ", log.Flags()|log.Lmsgprefix)
+}
+
+// guarda o status e se a resposta ja começou a ser escrita
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += n
+	return n, err
+}
+
+// permite que o http.ResponseController chegue no writer original
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// registra metodo, rota, status e duração de cada requisição
+func withAccessLog(route string) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			inicio := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			requestLogger(r.Context()).Printf("%s %s rota=%s status=%d bytes=%d duracao=%s",
+				r.Method, r.URL.Path, route, status, rec.bytes, time.Since(inicio))
+		})
+	}
+}
+
+// recupera panics do handler e responde um erro 500 em json
+func withRecover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec, ok := w.(*statusRecorder)
+		if !ok {
+			rec = &statusRecorder{ResponseWriter: w}
+		}
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			requestLogger(r.Context()).Printf("panic: %v\n%s", p, debug.Stack())
+			// se a resposta ja começou nao tem como trocar o status
+			if rec.status != 0 {
+				return
+			}
+			writeError(rec, r, newAPIError(http.StatusInternalServerError, codigoErroInterno, "erro interno no servidor"))
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// autentica a requisição e verifica o escopo exigido pelo metodo
+func withAuth(escopos map[string]string) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			escopo, ok := escopos[r.Method]
+			if !ok {
+				escopo, ok = escopos[""]
+			}
+			if !ok {
+				requestLogger(r.Context()).Println("metodo nao suportado")
+				writeError(w, r, newAPIError(http.StatusMethodNotAllowed, codigoMetodoNaoSuportado, "metodo nao suportado"))
+				return
+			}
+			principal, status, err := autorizar(r, escopo)
+			if err != nil {
+				requestLogger(r.Context()).Println("não autorizado:", err)
+				writeError(w, r, authError(status))
+				return
+			}
+			ctx := context.WithValue(r.Context(), principalKey, principal)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// principal autenticado pelo middleware
+func principalFrom(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey).(*Principal)
+	return p
+}
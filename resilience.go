@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// erro devolvido sem chamar o SOC enquanto o circuito do endpoint esta aberto
+var ErrCircuitoAberto = errors.New("SOC indisponível, circuito aberto")
+
+// disjuntor de um endpoint do SOC: abre depois de falhas seguidas e,
+// passado o tempo de espera, deixa uma chamada de teste passar
+type circuitBreaker struct {
+	mu        sync.Mutex
+	falhas    int
+	abertoAte time.Time
+	testando  bool
+}
+
+// disjuntores por endpoint do SOC
+var breakers = struct {
+	mu sync.Mutex
+	m  map[string]*circuitBreaker
+}{m: make(map[string]*circuitBreaker)}
+
+// disjuntor do endpoint, criado na primeira chamada
+func breakerFor(nome string) *circuitBreaker {
+	breakers.mu.Lock()
+	defer breakers.mu.Unlock()
+	b, ok := breakers.m[nome]
+	if !ok {
+		b = &circuitBreaker{}
+		breakers.m[nome] = b
+	}
+	return b
+}
+
+// verifica se a chamada pode seguir
+func (b *circuitBreaker) permitir(agora time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.abertoAte.IsZero() {
+		return true
+	}
+	// aberto: so libera uma chamada de teste depois do tempo de espera
+	if agora.Before(b.abertoAte) || b.testando {
+		return false
+	}
+	b.testando = true
+	return true
+}
+
+// registra o resultado da chamada, retorna true se o circuito ficou aberto
+func (b *circuitBreaker) registrar(ok bool, agora time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.testando = false
+	if ok {
+		b.falhas = 0
+		b.abertoAte = time.Time{}
+		return false
+	}
+	b.falhas++
+	if b.falhas >= cfg.Upstream.BreakerFailures || !b.abertoAte.IsZero() {
+		b.abertoAte = agora.Add(cfg.Upstream.BreakerCooldown)
+	}
+	return !b.abertoAte.IsZero()
+}
+
+// libera a chamada de teste que foi cancelada sem resultado
+func (b *circuitBreaker) cancelarTeste() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.testando = false
+}
+
+// chamada ao SOC passando pelo disjuntor do endpoint; leituras idempotentes
+// (repetir = true) sao repetidas com backoff exponencial e jitter. Escritas
+// SOAP so podem ser repetidas se forem marcadas como seguras pelo chamador.
+func doSOC(nome string, client *http.Client, req *http.Request, repetir bool, attrs ...attribute.KeyValue) (*http.Response, error) {
+	ctx := req.Context()
+	b := breakerFor(nome)
+	tentativas := 1
+	if repetir {
+		tentativas += cfg.Upstream.RetryMax
+	}
+	var res *http.Response
+	var err error
+	for tentativa := 0; tentativa < tentativas; tentativa++ {
+		if tentativa > 0 {
+			if err := esperarBackoff(ctx, tentativa); err != nil {
+				return nil, err
+			}
+			upstreamRetries.WithLabelValues(nome).Inc()
+			if req, err = clonarRequisicao(req); err != nil {
+				return nil, err
+			}
+		}
+		if !b.permitir(time.Now()) {
+			return nil, fmt.Errorf("%w: %s", ErrCircuitoAberto, nome)
+		}
+		res, err = doUpstream(nome, client, req, append(attrs[:len(attrs):len(attrs)], attribute.Int("soc.tentativa", tentativa+1))...)
+		// cancelamento pelo nosso lado nao diz nada sobre a saude do SOC
+		if err != nil && ctx.Err() != nil {
+			b.cancelarTeste()
+			return nil, err
+		}
+		falhou := err != nil || (falhaTemporaria(res.StatusCode) && !respostaFaultSOAP(res))
+		aberto := b.registrar(!falhou, time.Now())
+		upstreamCircuitOpen.WithLabelValues(nome).Set(boolToFloat(aberto))
+		if !falhou {
+			return res, nil
+		}
+		if tentativa < tentativas-1 && res != nil {
+			// descarta a resposta com erro antes de tentar de novo
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+	}
+	return res, err
+}
+
+// elemento Fault de um envelope SOAP, com ou sem prefixo
+var reFaultSOAP = regexp.MustCompile(`<(?:[\w-]+:)?Fault[\s>]`)
+
+// o SOAP do SOC devolve erros de negocio (validação, agenda cheia) como Fault com status 500.
+// eles mostram que o SOC esta de pé e nao contam como falha no disjuntor.
+// o corpo é lido e reposto para o chamador
+func respostaFaultSOAP(res *http.Response) bool {
+	if res.StatusCode != http.StatusInternalServerError || !strings.Contains(res.Header.Get("Content-Type"), "xml") {
+		return false
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	return err == nil && reFaultSOAP.Match(body)
+}
+
+// status que indicam falha passageira do SOC
+func falhaTemporaria(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// espera o backoff exponencial com jitter da tentativa, ou o cancelamento do contexto
+func esperarBackoff(ctx context.Context, tentativa int) error {
+	teto := cfg.Upstream.RetryBaseDelay << (tentativa - 1)
+	if teto > cfg.Upstream.RetryMaxDelay || teto <= 0 {
+		teto = cfg.Upstream.RetryMaxDelay
+	}
+	// o validate recusa atrasos negativos, mas o rand.Int64N entra em panico com teto <= 0
+	teto = max(teto, 1)
+	espera := time.Duration(rand.Int64N(int64(teto)) + 1)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(espera):
+		return nil
+	}
+}
+
+// copia a requisição para uma nova tentativa, recriando o corpo
+func clonarRequisicao(req *http.Request) (*http.Request, error) {
+	novo := req.Clone(req.Context())
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, fmt.Errorf("requisição para %s sem GetBody não pode ser repetida", req.URL.Path)
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		novo.Body = body
+	}
+	return novo, nil
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
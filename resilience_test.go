@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"sql-connect/internal/fakesoc"
+)
+
+func TestBreakerIgnoraFaultSOAP(t *testing.T) {
+	fs := novoSOCFalso(t, fixturesPadrao(t))
+	incluir := func() error {
+		return createAgendamento(context.Background(), "19/10/2026", "08:00", "EXAME", cfg.SOC.EmpresaPrincipal, "", cfg.SOC.AgendaClientes)
+	}
+
+	// agendamentos recusados pelo SOC com Fault nao abrem o circuito
+	fs.SetFalha(fakesoc.AlvoIncluirAgendamento, fakesoc.Falha{Fault: "horario nao permitido para a agenda"})
+	tentativas := cfg.Upstream.BreakerFailures + 2
+	for i := 0; i < tentativas; i++ {
+		if err := incluir(); errors.Is(err, ErrCircuitoAberto) {
+			t.Fatalf("circuito aberto depois de %d Faults", i)
+		}
+	}
+	if got := fs.Chamadas(fakesoc.AlvoIncluirAgendamento); got != tentativas {
+		t.Fatalf("SOC recebeu %d chamadas, esperava %d", got, tentativas)
+	}
+
+	// erro 500 sem Fault continua contando como falha do SOC
+	fs.SetFalha(fakesoc.AlvoIncluirAgendamento, fakesoc.Falha{Status: 500, Corpo: "<html>Erro interno</html>"})
+	for i := 0; i < cfg.Upstream.BreakerFailures; i++ {
+		if err := incluir(); errors.Is(err, ErrCircuitoAberto) {
+			t.Fatalf("circuito aberto antes do limite, na falha %d", i+1)
+		}
+	}
+	if err := incluir(); !errors.Is(err, ErrCircuitoAberto) {
+		t.Fatalf("esperava circuito aberto depois de %d falhas, veio %v", cfg.Upstream.BreakerFailures, err)
+	}
+}
+
+func TestEsperarBackoffComAtrasoNegativo(t *testing.T) {
+	cfgAnterior := cfg
+	t.Cleanup(func() { cfg = cfgAnterior })
+	cfg = defaultConfig()
+	cfg.Upstream.RetryBaseDelay = -time.Second
+	cfg.Upstream.RetryMaxDelay = -time.Second
+	// nao pode entrar em panico mesmo com a configuração fora do validate
+	for tentativa := 1; tentativa <= 3; tentativa++ {
+		if err := esperarBackoff(context.Background(), tentativa); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
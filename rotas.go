@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tipo de compromisso e empresa usados para escolher o codigo da agenda, vazios valem qualquer rota
+type filtroAgenda struct {
+	compromisso string
+	empresa     string
+}
+
+// rota validada, datas zeradas deixam o periodo aberto
+type rotaAgenda struct {
+	agenda      string
+	codigo      string
+	inicio      time.Time
+	fim         time.Time
+	compromisso string
+	empresa     string
+}
+
+// trecho de um periodo atendido pelo mesmo codigo de agenda
+type trechoAgenda struct {
+	codigo string
+	inicio time.Time
+	fim    time.Time
+}
+
+// rotas em uso, na ordem da configuração seguidas das do banco
+var rotasAgenda struct {
+	mu    sync.RWMutex
+	rotas []rotaAgenda
+}
+
+// valida as rotas configuradas e converte as datas
+func montarRotas(rotas []RotaAgenda) ([]rotaAgenda, error) {
+	res := make([]rotaAgenda, 0, len(rotas))
+	for i, r := range rotas {
+		onde := fmt.Sprintf("rotas_agenda.rotas[%d]", i)
+		if r.Agenda != agendaClientes && r.Agenda != agendaProteger {
+			return nil, fmt.Errorf("%s: agenda desconhecida %q, use %s ou %s", onde, r.Agenda, agendaClientes, agendaProteger)
+		}
+		if strings.TrimSpace(r.Codigo) == "" {
+			return nil, fmt.Errorf("%s: codigo é obrigatório", onde)
+		}
+		nova := rotaAgenda{
+			agenda:      r.Agenda,
+			codigo:      strings.TrimSpace(r.Codigo),
+			compromisso: strings.TrimSpace(r.Compromisso),
+			empresa:     strings.TrimSpace(r.Empresa),
+		}
+		var err error
+		if r.Inicio != "" {
+			if nova.inicio, err = parseDia(r.Inicio); err != nil {
+				return nil, fmt.Errorf("%s: inicio %q inválido, use dd/mm/aaaa", onde, r.Inicio)
+			}
+		}
+		if r.Fim != "" {
+			if nova.fim, err = parseDia(r.Fim); err != nil {
+				return nil, fmt.Errorf("%s: fim %q inválido, use dd/mm/aaaa", onde, r.Fim)
+			}
+		}
+		if !nova.inicio.IsZero() && !nova.fim.IsZero() && nova.fim.Before(nova.inicio) {
+			return nil, fmt.Errorf("%s: fim %s antes do inicio %s", onde, r.Fim, r.Inicio)
+		}
+		res = append(res, nova)
+	}
+	return res, nil
+}
+
+// a rota vale para a agenda no dia e para o compromisso e empresa pedidos
+func (r rotaAgenda) vale(agenda string, dia time.Time, f filtroAgenda) bool {
+	switch {
+	case r.agenda != agenda:
+		return false
+	case !r.inicio.IsZero() && dia.Before(r.inicio):
+		return false
+	case !r.fim.IsZero() && dia.After(r.fim):
+		return false
+	case r.compromisso != "" && !strings.EqualFold(r.compromisso, f.compromisso):
+		return false
+	case r.empresa != "" && r.empresa != f.empresa:
+		return false
+	}
+	return true
+}
+
+// rotas com empresa valem mais que com compromisso, que valem mais que as gerais
+func (r rotaAgenda) peso() int {
+	peso := 0
+	if r.empresa != "" {
+		peso += 2
+	}
+	if r.compromisso != "" {
+		peso++
+	}
+	return peso
+}
+
+// codigo da agenda no SOC para o dia. entre as rotas que valem fica a mais especifica,
+// no empate a de inicio mais recente e depois a ultima da lista.
+// sem rota vale o codigo da agenda em soc.agenda_clientes ou soc.agenda_proteger
+func rotearAgenda(agenda string, dia time.Time, f filtroAgenda) string {
+	rotasAgenda.mu.RLock()
+	defer rotasAgenda.mu.RUnlock()
+	var escolhida *rotaAgenda
+	for i := range rotasAgenda.rotas {
+		r := &rotasAgenda.rotas[i]
+		if !r.vale(agenda, dia, f) {
+			continue
+		}
+		if escolhida == nil || r.peso() > escolhida.peso() ||
+			(r.peso() == escolhida.peso() && !r.inicio.Before(escolhida.inicio)) {
+			escolhida = r
+		}
+	}
+	if escolhida != nil {
+		return escolhida.codigo
+	}
+	if agenda == agendaProteger {
+		return cfg.SOC.AgendaProteger
+	}
+	return cfg.SOC.AgendaClientes
+}
+
+// divide o periodo em trechos com o mesmo codigo de agenda, um por troca de rota
+func trechosAgenda(agenda string, inicio, fim time.Time, f filtroAgenda) []trechoAgenda {
+	var trechos []trechoAgenda
+	for dia := inicio; !dia.After(fim); dia = dia.AddDate(0, 0, 1) {
+		codigo := rotearAgenda(agenda, dia, f)
+		if n := len(trechos); n > 0 && trechos[n-1].codigo == codigo {
+			trechos[n-1].fim = dia
+			continue
+		}
+		trechos = append(trechos, trechoAgenda{codigo: codigo, inicio: dia, fim: dia})
+	}
+	return trechos
+}
+
+// junta as listas json de cada trecho em uma lista so
+func juntarListas(listas [][]byte) ([]byte, error) {
+	if len(listas) == 1 {
+		return listas[0], nil
+	}
+	var todos []json.RawMessage
+	for _, lista := range listas {
+		var itens []json.RawMessage
+		if err := json.Unmarshal(lista, &itens); err != nil {
+			return nil, err
+		}
+		todos = append(todos, itens...)
+	}
+	return json.Marshal(todos)
+}
+
+// criar a tabela de rotas se ja nao existe, datas nulas e compromisso ou empresa vazios valem para qualquer valor
+func createRotasAgendaTable(ctx context.Context, db *sql.DB) error {
+	query := `CREATE TABLE IF NOT EXISTS rotas_agenda (
+    id SERIAL PRIMARY KEY,
+    agenda VARCHAR(20) NOT NULL,
+    codigo VARCHAR(20) NOT NULL,
+    inicio DATE,
+    fim DATE,
+    compromisso VARCHAR(50) NOT NULL DEFAULT '',
+    empresa VARCHAR(20) NOT NULL DEFAULT ''
+);`
+	_, err := db.ExecContext(ctx, query)
+	return err
+}
+
+// le as rotas do banco na ordem de cadastro
+func fetchRotasAgenda(ctx context.Context, db *sql.DB) ([]RotaAgenda, error) {
+	rows, err := db.QueryContext(ctx, `SELECT agenda, codigo, inicio, fim, compromisso, empresa FROM rotas_agenda ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var rotas []RotaAgenda
+	for rows.Next() {
+		var r RotaAgenda
+		var inicio, fim sql.NullTime
+		if err := rows.Scan(&r.Agenda, &r.Codigo, &inicio, &fim, &r.Compromisso, &r.Empresa); err != nil {
+			return nil, err
+		}
+		if inicio.Valid {
+			r.Inicio = inicio.Time.Format("02/01/2006")
+		}
+		if fim.Valid {
+			r.Fim = fim.Time.Format("02/01/2006")
+		}
+		rotas = append(rotas, r)
+	}
+	return rotas, rows.Err()
+}
+
+// recarrega as rotas da configuração e, com a fonte postgres, do banco.
+// se o banco falhar as rotas anteriores continuam valendo, ou as da configuração na subida
+func atualizarRotasAgenda(ctx context.Context, db *sql.DB) error {
+	if cfg.RotasAgenda.Fonte != expedienteFontePostgres {
+		return aplicarRotas(cfg.RotasAgenda.Rotas)
+	}
+	doBanco, err := func() ([]RotaAgenda, error) {
+		if err := createRotasAgendaTable(ctx, db); err != nil {
+			return nil, fmt.Errorf("erro ao criar tabela de rotas das agendas: %w", err)
+		}
+		doBanco, err := fetchRotasAgenda(ctx, db)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao buscar rotas das agendas no banco: %w", err)
+		}
+		return doBanco, nil
+	}()
+	if err == nil {
+		// as rotas do banco vem depois e ganham das da configuração no empate
+		comBanco := append(append([]RotaAgenda{}, cfg.RotasAgenda.Rotas...), doBanco...)
+		if err = aplicarRotas(comBanco); err == nil {
+			return nil
+		}
+		err = fmt.Errorf("rotas das agendas inválidas no banco: %w", err)
+	}
+	rotasAgenda.mu.RLock()
+	carregado := rotasAgenda.rotas != nil
+	rotasAgenda.mu.RUnlock()
+	if !carregado {
+		if errConfig := aplicarRotas(cfg.RotasAgenda.Rotas); errConfig != nil {
+			return errConfig
+		}
+	}
+	return err
+}
+
+// valida as rotas e troca as em uso
+func aplicarRotas(configuradas []RotaAgenda) error {
+	rotas, err := montarRotas(configuradas)
+	if err != nil {
+		return err
+	}
+	rotasAgenda.mu.Lock()
+	rotasAgenda.rotas = rotas
+	rotasAgenda.mu.Unlock()
+	log.Printf("rotas das agendas carregadas: %d", len(rotas))
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"sql-connect/internal/fakesoc"
+)
+
+// chama a rota pelo mux da api, com a autenticação e os escopos de verdade
+func chamarRota(t *testing.T, metodo, alvo, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(metodo, alvo, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	newRouter(rotasAPI()).ServeHTTP(rec, req)
+	return rec
+}
+
+// ids dos setores devolvidos pelo GET /setor
+func idsSetores(t *testing.T, rec *httptest.ResponseRecorder) []string {
+	t.Helper()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET setor respondeu %d: %s", rec.Code, rec.Body.String())
+	}
+	var setores []SetorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &setores); err != nil {
+		t.Fatalf("resposta inválida %q: %v", rec.Body.String(), err)
+	}
+	ids := []string{}
+	for _, s := range setores {
+		ids = append(ids, s.ID)
+	}
+	return ids
+}
+
+// sobe o SOC falso com o cache de setores vazio
+func novoSOCFalsoSetores(t *testing.T, f fakesoc.Fixtures) *fakesoc.Server {
+	t.Helper()
+	fs := novoSOCFalso(t, f)
+	setoresCache.invalidar(chaveSetores)
+	t.Cleanup(func() { setoresCache.invalidar(chaveSetores) })
+	return fs
+}
+
+func TestSetoresComCodigoEmpresaComEspacos(t *testing.T) {
+	f := fixturesPadrao(t)
+	// o SOC as vezes devolve o codigo da empresa completado com espaços
+	for _, s := range f.Setores {
+		s["CODIGOEMPRESA"] = s["CODIGOEMPRESA"].(string) + "  "
+	}
+	novoSOCFalsoSetores(t, f)
+	token := tokenTeste(t, jwt.MapClaims{"sub": "portal", "scope": "setor:read"})
+
+	// fixtures: empresa 200 com os setores 1 e 2 ativos e o 3 inativo
+	if ids := idsSetores(t, chamarRota(t, "GET", "/api/v1/setor?empresa=200", token)); !slices.Equal(ids, []string{"1", "2"}) {
+		t.Errorf("setores da empresa 200 = %v", ids)
+	}
+	// a rota exige o escopo setor:read
+	semEscopo := tokenTeste(t, jwt.MapClaims{"sub": "portal", "scope": "cargo:read"})
+	if rec := chamarRota(t, "GET", "/api/v1/setor?empresa=200", semEscopo); rec.Code != http.StatusForbidden {
+		t.Errorf("GET setor sem o escopo respondeu %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestSetoresUmExportParaTodasAsEmpresas(t *testing.T) {
+	fs := novoSOCFalsoSetores(t, fixturesPadrao(t))
+	token := tokenTeste(t, jwt.MapClaims{"sub": "portal", "scope": "setor:read cache:write"})
+
+	if ids := idsSetores(t, chamarRota(t, "GET", "/api/v1/setor?empresa=200", token)); !slices.Equal(ids, []string{"1", "2"}) {
+		t.Errorf("setores da empresa 200 = %v", ids)
+	}
+	if ids := idsSetores(t, chamarRota(t, "GET", "/api/v1/setor?empresa=201", token)); !slices.Equal(ids, []string{"10"}) {
+		t.Errorf("setores da empresa 201 = %v", ids)
+	}
+	if got := fs.Chamadas(fakesoc.AlvoSetores); got != 1 {
+		t.Fatalf("export de setores baixado %d vezes para duas empresas", got)
+	}
+
+	// invalidar qualquer empresa descarta o export compartilhado
+	if rec := chamarRota(t, "POST", "/api/v1/admin/cache?empresa=201", token); rec.Code != http.StatusOK {
+		t.Fatalf("POST admin/cache respondeu %d: %s", rec.Code, rec.Body.String())
+	}
+	idsSetores(t, chamarRota(t, "GET", "/api/v1/setor?empresa=200", token))
+	if got := fs.Chamadas(fakesoc.AlvoSetores); got != 2 {
+		t.Errorf("export de setores baixado %d vezes depois da invalidação, esperava 2", got)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// tipos de erro devolvidos pelo SOC
+var (
+	ErrSOCNaoEncontrado = errors.New("registro não encontrado no SOC")
+	ErrSOCCredenciais   = errors.New("credenciais do SOC recusadas")
+	ErrSOCLimite        = errors.New("limite de consultas do SOC excedido")
+	ErrSOCFalha         = errors.New("falha no SOC")
+)
+
+// erro classificado de uma resposta do SOC
+type SOCError struct {
+	Tipo     error
+	Upstream string
+	Detalhe  string
+}
+
+func (e *SOCError) Error() string {
+	return fmt.Sprintf("exportadados %s: %v: %s", e.Upstream, e.Tipo, e.Detalhe)
+}
+
+func (e *SOCError) Unwrap() error {
+	return e.Tipo
+}
+
+// mensagens conhecidas do SOC, comparadas em minusculas
+var socMensagensErro = []struct {
+	trecho string
+	tipo   error
+}{
+	{"não encontrado exporta dados", ErrSOCNaoEncontrado},
+	{"empresa não encontrada", ErrSOCNaoEncontrado},
+	{"nenhum registro encontrado", ErrSOCNaoEncontrado},
+	{"chave inválida", ErrSOCCredenciais},
+	{"chave de acesso inválida", ErrSOCCredenciais},
+	{"chave informada não confere", ErrSOCCredenciais},
+	{"usuário ou senha inválid", ErrSOCCredenciais},
+	{"acesso negado", ErrSOCCredenciais},
+	{"limite de requisições", ErrSOCLimite},
+	{"limite de consultas", ErrSOCLimite},
+	{"excedeu o limite", ErrSOCLimite},
+	{"quantidade máxima de acessos", ErrSOCLimite},
+}
+
+// classifica a resposta de um exportadados, devolve nil quando o corpo é json
+func classificarRespostaSOC(nome string, status int, body []byte) error {
+	novo := func(tipo error, detalhe string) error {
+		return &SOCError{Tipo: tipo, Upstream: nome, Detalhe: detalhe}
+	}
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return novo(ErrSOCCredenciais, fmt.Sprintf("SOC respondeu %d", status))
+	case status == http.StatusTooManyRequests:
+		return novo(ErrSOCLimite, fmt.Sprintf("SOC respondeu %d", status))
+	case status == http.StatusNotFound:
+		return novo(ErrSOCNaoEncontrado, fmt.Sprintf("SOC respondeu %d", status))
+	case status >= 400:
+		return novo(ErrSOCFalha, fmt.Sprintf("SOC respondeu %d", status))
+	}
+	inicio := bytes.TrimSpace(body)
+	if len(inicio) == 0 {
+		return novo(ErrSOCFalha, "resposta vazia")
+	}
+	// os exports sempre devolvem uma lista ou objeto json, mensagens de erro vem em texto puro
+	if inicio[0] == '[' || inicio[0] == '{' {
+		return nil
+	}
+	texto := textoSOC(inicio)
+	minusculo := strings.ToLower(texto)
+	for _, m := range socMensagensErro {
+		if strings.Contains(minusculo, m.trecho) {
+			return novo(m.tipo, resumoSOC(texto))
+		}
+	}
+	if strings.HasPrefix(minusculo, "<!doctype html") || strings.HasPrefix(minusculo, "<html") {
+		return novo(ErrSOCFalha, "página de erro html")
+	}
+	return novo(ErrSOCFalha, "resposta inesperada: "+resumoSOC(texto))
+}
+
+// converte o corpo para texto utf8, o SOC responde em ISO-8859-1 na maioria dos exports
+func textoSOC(body []byte) string {
+	if utf8.Valid(body) {
+		return string(body)
+	}
+	convertido, err := charmap.ISO8859_1.NewDecoder().Bytes(body)
+	if err != nil {
+		return string(bytes.ToValidUTF8(body, nil))
+	}
+	return string(convertido)
+}
+
+// primeiros caracteres da mensagem do SOC para o log
+func resumoSOC(texto string) string {
+	texto = strings.Join(strings.Fields(texto), " ")
+	if r := []rune(texto); len(r) > 120 {
+		return string(r[:120]) + "..."
+	}
+	return texto
+}
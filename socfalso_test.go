@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"sql-connect/internal/fakesoc"
+)
+
+// feriados respondidos pelo Blip falso dos testes
+const feriadosTeste = "25/12-01/01"
+
+// status devolvido pelo Blip falso, 0 responde os feriados normalmente
+var statusBlipTeste atomic.Int32
+
+// sobe o SOC falso com as fixtures e aponta a configuração do ambiente local para ele,
+// junto com um Blip que responde so os feriados de feriadosTeste
+func novoSOCFalso(t *testing.T, f fakesoc.Fixtures) *fakesoc.Server {
+	t.Helper()
+	fs := fakesoc.New(f)
+	srv := httptest.NewServer(fs)
+	blip := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status := statusBlipTeste.Load(); status != 0 {
+			http.Error(w, "erro no Blip", int(status))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"type":"text/plain","resource":%q,"method":"get","status":"success"}`, feriadosTeste)
+	}))
+
+	cfgAnterior, clientAnterior, exportaAnterior, regrasAnterior := cfg, upstreamClient, socExporta, regrasCapacidade
+	t.Cleanup(func() {
+		srv.Close()
+		blip.Close()
+		cfg, upstreamClient, socExporta, regrasCapacidade = cfgAnterior, clientAnterior, exportaAnterior, regrasAnterior
+		limparBreakers()
+		statusBlipTeste.Store(0)
+	})
+
+	c := defaultConfig()
+	c.SOC.Ambiente = socAmbienteLocal
+	c.aplicarAmbienteSOC()
+	c.SOC.BaseURL = srv.URL
+	c.Blip.URL = blip.URL
+	c.Blip.Key = "teste"
+	c.Database.DSN = "postgres://teste"
+	c.Upstream.RetryBaseDelay = time.Millisecond
+	c.Upstream.RetryMaxDelay = time.Millisecond
+	if err := c.validate(); err != nil {
+		t.Fatal(err)
+	}
+	cfg = c
+	limparBreakers()
+	var err error
+	if regrasCapacidade, err = montarCapacidade(cfg.Capacidade); err != nil {
+		t.Fatal(err)
+	}
+	if err := atualizarExpediente(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := atualizarRotasAgenda(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	upstreamClient = newUpstreamClient(cfg.Upstream)
+	socExporta = &exportaDadosClient{baseURL: socURL(socCaminhoExportadados), client: upstreamClient}
+	return fs
+}
+
+// liga o jwt com uma chave HS256 de teste e assina um token com as claims informadas,
+// a validade de uma hora é colocada quando as claims nao tem exp
+func tokenTeste(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	segredo := []byte("segredo-de-teste")
+	chavesAnteriores := jwtKeys
+	t.Cleanup(func() { jwtKeys = chavesAnteriores })
+	jwtKeys = &jwkSet{chaves: map[string]any{"teste": segredo}, algs: map[string]string{"teste": "HS256"}}
+	if _, ok := claims["exp"]; !ok {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = "teste"
+	assinado, err := token.SignedString(segredo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return assinado
+}
+
+// fixtures padrao do SOC falso
+func fixturesPadrao(t *testing.T) fakesoc.Fixtures {
+	t.Helper()
+	f, err := fakesoc.LoadFixtures("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// zera os disjuntores entre os testes
+func limparBreakers() {
+	breakers.mu.Lock()
+	breakers.m = make(map[string]*circuitBreaker)
+	breakers.mu.Unlock()
+}